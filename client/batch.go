@@ -0,0 +1,290 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// Batch builds an ordered list of operations which are executed by a single
+// ARI proxy in one round trip.
+//
+// The handles returned by the builder methods refer to entities which do not
+// exist until the Batch is executed.  If the reference key of the Batch does
+// not specify a node, the handles become fully addressable once Exec returns.
+type Batch struct {
+	c *Client
+
+	ref *ari.Key
+
+	req proxy.Batch
+
+	// keys are the keys of all handles returned by the builder, which are
+	// completed with the location of the executing node
+	keys []*ari.Key
+}
+
+// Batch returns a new Batch builder whose operations will be executed on the
+// node indicated by the given reference key.  If the reference key does not
+// specify a node, any node serving the application may execute the Batch.
+func (c *Client) Batch(ref *ari.Key) *Batch {
+	if ref == nil {
+		ref = ari.NewKey("", "", ari.WithApp(c.appName))
+	}
+	return &Batch{
+		c:   c,
+		ref: ref,
+	}
+}
+
+// ContinueOnError causes the remaining operations of the Batch to be executed even after one of them fails
+func (b *Batch) ContinueOnError() *Batch {
+	b.req.ContinueOnError = true
+	return b
+}
+
+// Dialog causes all operations of the Batch to be executed under the given dialog
+func (b *Batch) Dialog(id string) *Batch {
+	b.req.Dialog = id
+	return b
+}
+
+// Add appends an arbitrary request to the Batch
+func (b *Batch) Add(req *proxy.Request) *Batch {
+	b.req.Requests = append(b.req.Requests, req)
+	return b
+}
+
+// Len returns the number of operations in the Batch
+func (b *Batch) Len() int {
+	return len(b.req.Requests)
+}
+
+func (b *Batch) key(kind, id string) *ari.Key {
+	k := ari.NewKey(kind, id, ari.WithLocationOf(b.ref))
+	b.keys = append(b.keys, k)
+	return k
+}
+
+// BridgeCreate adds the creation of a bridge.  If key does not specify an ID, one is generated.
+func (b *Batch) BridgeCreate(key *ari.Key, btype, name string) *ari.BridgeHandle {
+	id := rid.New(rid.Bridge)
+	if key != nil && key.ID != "" {
+		id = key.ID
+	}
+	k := b.key(ari.BridgeKey, id)
+
+	b.Add(&proxy.Request{
+		Kind: "BridgeCreate",
+		Key:  k,
+		BridgeCreate: &proxy.BridgeCreate{
+			Type: btype,
+			Name: name,
+		},
+	})
+	return ari.NewBridgeHandle(k, b.c.Bridge(), nil)
+}
+
+// BridgeAddChannel adds the addition of a channel to a bridge
+func (b *Batch) BridgeAddChannel(key *ari.Key, channelID string) *Batch {
+	return b.Add(&proxy.Request{
+		Kind: "BridgeAddChannel",
+		Key:  key,
+		BridgeAddChannel: &proxy.BridgeAddChannel{
+			Channel: channelID,
+		},
+	})
+}
+
+// BridgeRemoveChannel adds the removal of a channel from a bridge
+func (b *Batch) BridgeRemoveChannel(key *ari.Key, channelID string) *Batch {
+	return b.Add(&proxy.Request{
+		Kind: "BridgeRemoveChannel",
+		Key:  key,
+		BridgeRemoveChannel: &proxy.BridgeRemoveChannel{
+			Channel: channelID,
+		},
+	})
+}
+
+// BridgeDelete adds the deletion of a bridge
+func (b *Batch) BridgeDelete(key *ari.Key) *Batch {
+	return b.Add(&proxy.Request{
+		Kind: "BridgeDelete",
+		Key:  key,
+	})
+}
+
+// BridgePlay adds a playback to a bridge.  If playbackID is empty, one is generated.
+func (b *Batch) BridgePlay(key *ari.Key, playbackID string, mediaURI string) *ari.PlaybackHandle {
+	if playbackID == "" {
+		playbackID = rid.New(rid.Playback)
+	}
+
+	b.Add(&proxy.Request{
+		Kind: "BridgePlay",
+		Key:  key,
+		BridgePlay: &proxy.BridgePlay{
+			PlaybackID: playbackID,
+			MediaURI:   mediaURI,
+		},
+	})
+	return ari.NewPlaybackHandle(b.key(ari.PlaybackKey, playbackID), b.c.Playback(), nil)
+}
+
+// ChannelOriginate adds the origination of a channel.  If the request does not specify a channel ID, one is generated.
+func (b *Batch) ChannelOriginate(referenceKey *ari.Key, o ari.OriginateRequest) *ari.ChannelHandle {
+	if o.ChannelID == "" {
+		o.ChannelID = rid.New(rid.Channel)
+	}
+
+	b.Add(&proxy.Request{
+		Kind: "ChannelOriginate",
+		Key:  referenceKey,
+		ChannelOriginate: &proxy.ChannelOriginate{
+			OriginateRequest: o,
+		},
+	})
+	return ari.NewChannelHandle(b.key(ari.ChannelKey, o.ChannelID), b.c.Channel(), nil)
+}
+
+// ChannelCreate adds the creation of a channel.  If the request does not specify a channel ID, one is generated.
+func (b *Batch) ChannelCreate(key *ari.Key, o ari.ChannelCreateRequest) *ari.ChannelHandle {
+	if o.ChannelID == "" {
+		o.ChannelID = rid.New(rid.Channel)
+	}
+
+	b.Add(&proxy.Request{
+		Kind: "ChannelCreate",
+		Key:  key,
+		ChannelCreate: &proxy.ChannelCreate{
+			ChannelCreateRequest: o,
+		},
+	})
+	return ari.NewChannelHandle(b.key(ari.ChannelKey, o.ChannelID), b.c.Channel(), nil)
+}
+
+// ChannelAnswer adds the answering of a channel
+func (b *Batch) ChannelAnswer(key *ari.Key) *Batch {
+	return b.Add(&proxy.Request{
+		Kind: "ChannelAnswer",
+		Key:  key,
+	})
+}
+
+// ChannelHangup adds the hangup of a channel
+func (b *Batch) ChannelHangup(key *ari.Key, reason string) *Batch {
+	return b.Add(&proxy.Request{
+		Kind: "ChannelHangup",
+		Key:  key,
+		ChannelHangup: &proxy.ChannelHangup{
+			Reason: reason,
+		},
+	})
+}
+
+// ChannelSetVariable adds the setting of a channel variable
+func (b *Batch) ChannelSetVariable(key *ari.Key, name, value string) *Batch {
+	return b.Add(&proxy.Request{
+		Kind: "ChannelVariableSet",
+		Key:  key,
+		ChannelVariable: &proxy.ChannelVariable{
+			Name:  name,
+			Value: value,
+		},
+	})
+}
+
+// ChannelSendDTMF adds the sending of DTMF to a channel
+func (b *Batch) ChannelSendDTMF(key *ari.Key, dtmf string, opts *ari.DTMFOptions) *Batch {
+	return b.Add(&proxy.Request{
+		Kind: "ChannelSendDTMF",
+		Key:  key,
+		ChannelSendDTMF: &proxy.ChannelSendDTMF{
+			DTMF:    dtmf,
+			Options: opts,
+		},
+	})
+}
+
+// ChannelPlay adds a playback to a channel.  If playbackID is empty, one is generated.
+func (b *Batch) ChannelPlay(key *ari.Key, playbackID string, mediaURI string) *ari.PlaybackHandle {
+	if playbackID == "" {
+		playbackID = rid.New(rid.Playback)
+	}
+
+	b.Add(&proxy.Request{
+		Kind: "ChannelPlay",
+		Key:  key,
+		ChannelPlay: &proxy.ChannelPlay{
+			PlaybackID: playbackID,
+			MediaURI:   mediaURI,
+		},
+	})
+	return ari.NewPlaybackHandle(b.key(ari.PlaybackKey, playbackID), b.c.Playback(), nil)
+}
+
+// ChannelRecord adds a recording of a channel.  If name is empty, one is generated.
+func (b *Batch) ChannelRecord(key *ari.Key, name string, opts *ari.RecordingOptions) *ari.LiveRecordingHandle {
+	if opts == nil {
+		opts = &ari.RecordingOptions{}
+	}
+	if name == "" {
+		name = rid.New(rid.Recording)
+	}
+
+	b.Add(&proxy.Request{
+		Kind: "ChannelRecord",
+		Key:  key,
+		ChannelRecord: &proxy.ChannelRecord{
+			Name:    name,
+			Options: opts,
+		},
+	})
+	return ari.NewLiveRecordingHandle(b.key(ari.LiveRecordingKey, name), b.c.LiveRecording(), nil)
+}
+
+// Exec executes the Batch.  The returned responses correspond, in order, to
+// the operations which were executed.  The returned error is that of the
+// Batch itself or of the first operation which failed.
+func (b *Batch) Exec() ([]*proxy.Response, error) {
+	if len(b.req.Requests) == 0 {
+		return nil, nil
+	}
+
+	resp, err := b.c.makeRequest("create", &proxy.Request{
+		Kind:  "Batch",
+		Key:   b.ref,
+		Batch: &b.req,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = resp.Err(); err != nil {
+		return nil, err
+	}
+
+	// Complete the location of the returned handles
+	if resp.Key != nil {
+		for _, k := range b.keys {
+			if k.Node == "" {
+				k.Node = resp.Key.Node
+			}
+			if k.App == "" {
+				k.App = resp.Key.App
+			}
+		}
+	}
+
+	for i, r := range resp.Responses {
+		if err = r.Err(); err != nil {
+			return resp.Responses, eris.Wrapf(err, "batch operation %d (%s) failed", i, b.req.Requests[i].Kind)
+		}
+	}
+	if len(resp.Responses) < len(b.req.Requests) {
+		return resp.Responses, eris.Errorf("only %d of %d batch operations were executed", len(resp.Responses), len(b.req.Requests))
+	}
+
+	return resp.Responses, nil
+}
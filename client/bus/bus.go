@@ -3,8 +3,10 @@ package bus
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
 	"github.com/inconshreveable/log15"
 )
@@ -20,15 +22,97 @@ type Bus struct {
 	log log15.Logger
 
 	mbus messagebus.Client
+
+	// typed indicates that subscriptions should be made to the typed event
+	// subjects rather than to the legacy event subjects
+	typed bool
+
+	// mux multiplexes the subscriptions of the Bus over MessageBus
+	mux *Mux
+
+	// subOpts are the options of the Subscriptions made by Subscribe
+	subOpts SubscriptionOptions
+}
+
+// Option is a function which configures a Bus
+type Option func(*Bus)
+
+// WithTypedSubjects configures the Bus to subscribe to the typed event
+// subjects (see proxy.TypedEventSubject), so that events are filtered by type
+// and entity within the MessageBus rather than by the client.  The ARI proxy
+// servers must publish typed event subjects (the "typed" or "compat" event
+// subject modes).
+func WithTypedSubjects() Option {
+	return func(b *Bus) {
+		b.typed = true
+	}
+}
+
+// WithMux configures the Bus to multiplex its subscriptions over the given
+// Mux, which may be shared with other Buses.  By default, each Bus has a Mux
+// of its own.
+func WithMux(m *Mux) Option {
+	return func(b *Bus) {
+		b.mux = m
+	}
 }
 
 // New returns a new Bus
-func New(prefix string, m messagebus.Client, log log15.Logger) *Bus {
-	return &Bus{
+func New(prefix string, m messagebus.Client, log log15.Logger, opts ...Option) *Bus {
+	b := &Bus{
 		prefix: prefix,
 		log:    log,
 		mbus:   m,
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.mux == nil {
+		b.mux = NewMux(m, log)
+	}
+	return b
+}
+
+// subjects returns the MessageBus subjects to which a subscription for the
+// given key and event types should be made
+func (b *Bus) subjects(key *ari.Key, n []string) []string {
+	if !b.typed || (key != nil && key.Dialog != "") {
+		return []string{b.subjectFromKey(key)}
+	}
+
+	wildcard := b.mbus.GetWildcardString(messagebus.WildcardOneWord)
+	token := func(v string) string {
+		if v == "" {
+			return wildcard
+		}
+		return proxy.EscapeSubjectToken(v)
+	}
+
+	var app, node, kind, id string
+	if key != nil {
+		app, node, kind, id = key.App, key.Node, key.Kind, key.ID
+	}
+
+	types := n
+	for _, t := range n {
+		if t == ari.Events.All {
+			types = nil
+			break
+		}
+	}
+	if len(types) == 0 {
+		types = []string{""}
+	}
+
+	ret := make([]string, 0, len(types))
+	for _, t := range types {
+		subj := fmt.Sprintf("%stypedevent.%s.%s.%s", b.prefix, token(app), token(node), token(t))
+		if kind != "" && id != "" {
+			subj += "." + proxy.EscapeSubjectToken(kind) + "." + proxy.EscapeSubjectToken(id)
+		}
+		ret = append(ret, subj)
+	}
+	return ret
 }
 
 func (b *Bus) subjectFromKey(key *ari.Key) string {
@@ -62,14 +146,29 @@ type Subscription struct {
 
 	log log15.Logger
 
-	subscription messagebus.Subscription
+	mux *Mux
+
+	// subjects are the multiplexed MessageBus subjects to which the Subscription is attached
+	subjects []*muxSubject
 
 	eventChan chan ari.Event
 
 	events []string
 
+	opts SubscriptionOptions
+
+	dropped atomic.Int64
+
+	// done is closed when the Subscription is cancelled, releasing any blocked senders
+	done chan struct{}
+
+	// senders tracks the deliveries in progress, which must finish before the event channel is closed
+	senders sync.WaitGroup
+
 	closed bool
 
+	err error
+
 	mu sync.RWMutex
 }
 
@@ -85,13 +184,27 @@ func (b *Bus) Send(e ari.Event) {
 
 // Subscribe implements ari.Bus
 func (b *Bus) Subscribe(key *ari.Key, n ...string) ari.Subscription {
-	var err error
+	if s := b.SubscribeWithOptions(key, b.subOpts, n...); s != nil {
+		return s
+	}
+	return nil
+}
+
+// SubscribeWithOptions subscribes to the given event types for the given key,
+// buffering events as described by the given options
+func (b *Bus) SubscribeWithOptions(key *ari.Key, o SubscriptionOptions, n ...string) *Subscription {
+	if o.BufferSize < 1 {
+		o.BufferSize = EventChanBufferLength
+	}
 
 	s := &Subscription{
 		key:       key,
 		log:       b.log,
-		eventChan: make(chan ari.Event, EventChanBufferLength),
+		mux:       b.mux,
+		eventChan: make(chan ari.Event, o.BufferSize),
 		events:    n,
+		opts:      o,
+		done:      make(chan struct{}),
 	}
 
 	var app string
@@ -99,14 +212,17 @@ func (b *Bus) Subscribe(key *ari.Key, n ...string) ari.Subscription {
 		app = key.App
 	}
 
-	s.subscription, err = b.mbus.SubscribeEvent(
-		b.subjectFromKey(key),
-		app,
-		s.receive,
-	)
-	if err != nil {
-		b.log.Error("failed to subscribe to MessageBus", "error", err)
-		return nil
+	// Only the legacy event subjects carry the whole event streams of the
+	// proxies, whose sequences may therefore be checked, unless the events
+	// are divided among the consumers of a shared queue
+	sequenced := !b.typed && (key == nil || key.Dialog == "") && !messagebus.SharedEventQueues(b.mbus)
+
+	for _, subj := range b.subjects(key, n) {
+		if err := b.mux.subscribe(subj, app, sequenced, s); err != nil {
+			b.log.Error("failed to subscribe to MessageBus", "error", err)
+			s.Cancel()
+			return nil
+		}
 	}
 	return s
 }
@@ -122,35 +238,59 @@ func (s *Subscription) Cancel() {
 		return
 	}
 
-	if s.subscription != nil {
-		err := s.subscription.Unsubscribe()
-		if err != nil {
-			s.log.Error("failed unsubscribe from MessageBus", "error", err)
-		}
+	if s.mux != nil {
+		s.mux.unsubscribe(s)
 	}
 
 	s.mu.Lock()
-	if !s.closed {
-		s.closed = true
-		close(s.eventChan)
+	if s.closed {
+		s.mu.Unlock()
+		return
 	}
+	s.closed = true
+	close(s.done)
 	s.mu.Unlock()
+
+	s.senders.Wait()
+	close(s.eventChan)
 }
 
-func (s *Subscription) receive(data []byte) {
-	e, err := ari.DecodeEvent(data)
-	if err != nil {
-		s.log.Error("failed to convert received message to ari.Event", "error", err)
+// deliver sends a matched event to the Subscription's event channel
+func (s *Subscription) deliver(e ari.Event) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
 		return
 	}
+	s.senders.Add(1)
+	s.mu.RUnlock()
+
+	dropped := s.send(e)
+	s.senders.Done()
 
-	if s.matchEvent(e) {
-		s.mu.RLock()
-		if !s.closed {
-			s.eventChan <- e
+	if dropped && s.opts.Policy == OverflowClose {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = ErrOverflow
 		}
-		s.mu.RUnlock()
+		s.mu.Unlock()
+
+		s.Cancel()
+	}
+}
+
+// indexKeys returns the keys under which the Subscription is indexed by its Mux
+func (s *Subscription) indexKeys() []indexKey {
+	var id string
+	if s.key != nil {
+		id = s.key.ID
+	}
+
+	ret := make([]indexKey, 0, len(s.events))
+	for _, t := range s.events {
+		ret = append(ret, indexKey{id: id, eventType: t})
 	}
+	return ret
 }
 
 func (s *Subscription) matchEvent(o ari.Event) bool {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/inconshreveable/log15"
 
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
 	"github.com/CyCoreSystems/ari/v5"
 )
 
@@ -50,3 +51,31 @@ func TestMatchEvent(t *testing.T) {
 		t.Error("matched incorrect event")
 	}
 }
+
+func TestTypedSubjects(t *testing.T) {
+	b := New("ari.", &messagebus.NatsBus{}, log15.New(), WithTypedSubjects())
+
+	subjects := b.subjects(ari.NewKey(ari.ChannelKey, "1234.5", ari.WithApp("test")), []string{"StasisEnd", "ChannelDestroyed"})
+	expected := []string{
+		"ari.typedevent.test.*.StasisEnd.channel.1234%2E5",
+		"ari.typedevent.test.*.ChannelDestroyed.channel.1234%2E5",
+	}
+	if len(subjects) != len(expected) {
+		t.Fatalf("unexpected subjects: %v", subjects)
+	}
+	for i := range expected {
+		if subjects[i] != expected[i] {
+			t.Errorf("subject %q != %q", subjects[i], expected[i])
+		}
+	}
+
+	subjects = b.subjects(nil, []string{ari.Events.All})
+	if len(subjects) != 1 || subjects[0] != "ari.typedevent.*.*.*" {
+		t.Errorf("unexpected subjects for all events: %v", subjects)
+	}
+
+	subjects = b.subjects(ari.NewKey("", "", ari.WithDialog("d1")), []string{"StasisEnd"})
+	if len(subjects) != 1 || subjects[0] != "ari.dialogevent.d1" {
+		t.Errorf("unexpected subjects for dialog: %v", subjects)
+	}
+}
@@ -0,0 +1,261 @@
+package bus
+
+import (
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+)
+
+// Mux multiplexes event Subscriptions over MessageBus.  It holds a single
+// MessageBus subscription for each subject, decodes each event received once,
+// and dispatches it, through an index keyed by entity and event type, to the
+// matching Subscriptions.  A Mux is normally shared by every Bus of a client
+// core.  Since each Subscription receives the same decoded event, events
+// must not be modified by their recipients.
+type Mux struct {
+	mbus messagebus.Client
+
+	log log15.Logger
+
+	subjects map[muxKey]*muxSubject
+
+	mu sync.RWMutex
+}
+
+// muxKey identifies a MessageBus subscription by its subject and queue
+type muxKey struct {
+	subject string
+	queue   string
+}
+
+// indexKey identifies the Subscriptions to an event type for an entity ID.
+// Subscriptions which are not limited to an entity are indexed by the empty
+// ID.
+type indexKey struct {
+	id        string
+	eventType string
+}
+
+// muxSubject is a MessageBus subscription shared by a set of Subscriptions
+type muxSubject struct {
+	key muxKey
+
+	sub messagebus.Subscription
+
+	// ready is closed once the MessageBus subscription has been made or has
+	// failed with err
+	ready chan struct{}
+	err   error
+
+	index map[indexKey]map[*Subscription]struct{}
+
+	// sequence follows the event sequences of the ARI proxies, if the
+	// subject carries their whole event streams
+	sequence *sequenceTracker
+
+	// refs is the number of Subscriptions attached to the subject
+	refs int
+}
+
+// NewMux returns a new Mux over the given MessageBus client
+func NewMux(m messagebus.Client, log log15.Logger) *Mux {
+	return &Mux{
+		mbus:     m,
+		log:      log,
+		subjects: make(map[muxKey]*muxSubject),
+	}
+}
+
+// subscribe attaches the Subscription to the given subject, subscribing to
+// the subject on the MessageBus if the Subscription is its first.  If
+// sequenced is set, the subject carries the whole event streams of the ARI
+// proxies, so their event sequences are checked.
+//
+// The MessageBus subscription is made without holding the lock, so that the
+// dispatch of events is not stalled by the round trip to the broker.  Other
+// Subscriptions to the same subject meanwhile wait for its outcome.
+func (m *Mux) subscribe(subject, queue string, sequenced bool, s *Subscription) error {
+	k := muxKey{subject: subject, queue: queue}
+
+	m.mu.Lock()
+	ms, ok := m.subjects[k]
+	if !ok {
+		ms = &muxSubject{
+			key:   k,
+			index: make(map[indexKey]map[*Subscription]struct{}),
+			ready: make(chan struct{}),
+		}
+		if sequenced {
+			ms.sequence = newSequenceTracker()
+		}
+		m.subjects[k] = ms
+	}
+	m.attach(ms, s)
+	m.mu.Unlock()
+
+	if !ok {
+		sub, err := m.mbus.SubscribeEvent(subject, queue, func(data []byte) {
+			m.dispatch(ms, data)
+		})
+
+		m.mu.Lock()
+		ms.sub, ms.err = sub, err
+		if err != nil && m.subjects[k] == ms {
+			delete(m.subjects, k)
+		}
+		m.mu.Unlock()
+
+		close(ms.ready)
+	}
+	<-ms.ready
+
+	if ms.err != nil {
+		m.mu.Lock()
+		m.detach(ms, s)
+		m.mu.Unlock()
+		return ms.err
+	}
+	return nil
+}
+
+// attach adds the Subscription to the index of the subject.  The caller must
+// hold the lock.
+func (m *Mux) attach(ms *muxSubject, s *Subscription) {
+	for _, ik := range s.indexKeys() {
+		set, ok := ms.index[ik]
+		if !ok {
+			set = make(map[*Subscription]struct{})
+			ms.index[ik] = set
+		}
+		set[s] = struct{}{}
+	}
+	ms.refs++
+	s.subjects = append(s.subjects, ms)
+}
+
+// detach removes the Subscription from the index of the subject, returning
+// whether the subject is no longer used.  The caller must hold the lock.
+func (m *Mux) detach(ms *muxSubject, s *Subscription) bool {
+	for _, ik := range s.indexKeys() {
+		if set, ok := ms.index[ik]; ok {
+			delete(set, s)
+			if len(set) == 0 {
+				delete(ms.index, ik)
+			}
+		}
+	}
+	for i, sub := range s.subjects {
+		if sub == ms {
+			s.subjects = append(s.subjects[:i], s.subjects[i+1:]...)
+			break
+		}
+	}
+
+	ms.refs--
+	return ms.refs < 1
+}
+
+// unsubscribe detaches the Subscription from each of its subjects,
+// unsubscribing from the MessageBus any subject which is no longer used.
+func (m *Mux) unsubscribe(s *Subscription) {
+	var unused []*muxSubject
+
+	m.mu.Lock()
+	for _, ms := range append([]*muxSubject(nil), s.subjects...) {
+		if m.detach(ms, s) && m.subjects[ms.key] == ms {
+			delete(m.subjects, ms.key)
+			unused = append(unused, ms)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, ms := range unused {
+		// The subject may still be in the process of being subscribed
+		<-ms.ready
+		if ms.sub == nil {
+			continue
+		}
+		if err := ms.sub.Unsubscribe(); err != nil {
+			m.log.Error("failed unsubscribe from MessageBus", "error", err)
+		}
+	}
+}
+
+// dispatch decodes an event received on the given subject and delivers it to
+// each matching Subscription
+func (m *Mux) dispatch(ms *muxSubject, data []byte) {
+	se, err := proxy.DecodeSequencedEvent(data)
+	if err != nil {
+		m.log.Error("failed to convert received message to ari.Event", "error", err)
+		return
+	}
+	e := se.Event
+
+	if ms.sequence != nil {
+		if gap := ms.sequence.check(se); gap != nil {
+			m.reportGap(ms, gap)
+		}
+	}
+
+	ids := []string{""}
+	for _, k := range e.Keys() {
+		if k != nil && k.ID != "" {
+			ids = append(ids, k.ID)
+		}
+	}
+
+	var targets []*Subscription
+	seen := make(map[*Subscription]bool)
+
+	m.mu.RLock()
+	for _, t := range []string{e.GetType(), ari.Events.All} {
+		for _, id := range ids {
+			for s := range ms.index[indexKey{id: id, eventType: t}] {
+				if !seen[s] {
+					seen[s] = true
+					targets = append(targets, s)
+				}
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, s := range targets {
+		if !s.matchEvent(e) {
+			continue
+		}
+		if s.opts.Sequenced {
+			s.deliver(se)
+		} else {
+			s.deliver(e)
+		}
+	}
+}
+
+// reportGap surfaces the SequenceGap to each Subscription of the subject
+func (m *Mux) reportGap(ms *muxSubject, g *SequenceGap) {
+	seen := make(map[*Subscription]bool)
+
+	m.mu.RLock()
+	for _, set := range ms.index {
+		for s := range set {
+			seen[s] = true
+		}
+	}
+	m.mu.RUnlock()
+
+	for s := range seen {
+		s.reportGap(g)
+	}
+}
+
+// Subjects returns the number of MessageBus subscriptions held by the Mux
+func (m *Mux) Subjects() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.subjects)
+}
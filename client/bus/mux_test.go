@@ -0,0 +1,153 @@
+package bus
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+type testMessageBus struct {
+	messagebus.NatsBus
+
+	handlers map[string]messagebus.EventHandler
+
+	// gates, if set, holds the subscription to each listed subject until the gate is closed
+	gates map[string]chan struct{}
+
+	mu sync.Mutex
+}
+
+type testSubscription struct {
+	b       *testMessageBus
+	subject string
+}
+
+func (s *testSubscription) Unsubscribe() error {
+	s.b.mu.Lock()
+	delete(s.b.handlers, s.subject)
+	s.b.mu.Unlock()
+	return nil
+}
+
+func (b *testMessageBus) SubscribeEvent(topic string, queue string, callback messagebus.EventHandler) (messagebus.Subscription, error) {
+	if gate, ok := b.gates[topic]; ok {
+		<-gate
+	}
+
+	b.mu.Lock()
+	b.handlers[topic] = callback
+	b.mu.Unlock()
+	return &testSubscription{b: b, subject: topic}, nil
+}
+
+func TestMux(t *testing.T) {
+	m := &testMessageBus{handlers: make(map[string]messagebus.EventHandler)}
+	b := New("ari.", m, log15.New())
+
+	s1 := b.Subscribe(ari.NewKey(ari.ChannelKey, "c1", ari.WithApp("test")), ari.Events.StasisEnd)
+	s2 := b.Subscribe(ari.NewKey(ari.ChannelKey, "c2", ari.WithApp("test")), ari.Events.StasisEnd)
+	s3 := b.Subscribe(ari.NewKey("", "", ari.WithApp("test")), ari.Events.All)
+
+	if len(m.handlers) != 1 || b.mux.Subjects() != 1 {
+		t.Fatalf("expected a single MessageBus subscription; got %d", len(m.handlers))
+	}
+
+	m.handlers["ari.event.test.>"]([]byte(`{"type":"StasisEnd","application":"test","channel":{"id":"c1"}}`))
+
+	if len(s1.Events()) != 1 {
+		t.Error("event was not delivered to the subscription for its channel")
+	}
+	if len(s2.Events()) != 0 {
+		t.Error("event was delivered to the subscription for another channel")
+	}
+	if len(s3.Events()) != 1 {
+		t.Error("event was not delivered to the wildcard subscription")
+	}
+
+	s1.Cancel()
+	s2.Cancel()
+	if len(m.handlers) != 1 {
+		t.Error("MessageBus subscription was removed while still in use")
+	}
+
+	s3.Cancel()
+	if len(m.handlers) != 0 || b.mux.Subjects() != 0 {
+		t.Error("unused MessageBus subscription was not removed")
+	}
+}
+
+func TestMuxSequenced(t *testing.T) {
+	m := &testMessageBus{handlers: make(map[string]messagebus.EventHandler)}
+	b := New("ari.", m, log15.New())
+
+	key := ari.NewKey("", "", ari.WithApp("test"))
+	plain := b.Subscribe(key, ari.Events.StasisEnd)
+	sequenced := b.SubscribeWithOptions(key, SubscriptionOptions{Sequenced: true}, ari.Events.StasisEnd)
+
+	m.handlers["ari.event.test.>"]([]byte(`{"type":"StasisEnd","application":"test","channel":{"id":"c1"},"proxy_seq":5,"proxy_boot":"b1"}`))
+
+	if e := <-plain.Events(); e.GetType() != ari.Events.StasisEnd {
+		t.Errorf("unexpected event: %v", e)
+	} else if _, ok := e.(*ari.StasisEnd); !ok {
+		t.Errorf("expected bare event, got %T", e)
+	}
+
+	se, ok := (<-sequenced.Events()).(*proxy.SequencedEvent)
+	if !ok {
+		t.Fatal("expected sequenced event")
+	}
+	if _, ok := se.Event.(*ari.StasisEnd); !ok || se.Seq != 5 || se.Boot != "b1" {
+		t.Errorf("unexpected sequenced event: %T %+v", se.Event, se.EventSequence)
+	}
+}
+
+func TestMuxSubscribeDoesNotBlockDispatch(t *testing.T) {
+	gate := make(chan struct{})
+	m := &testMessageBus{
+		handlers: make(map[string]messagebus.EventHandler),
+		gates:    map[string]chan struct{}{"ari.dialogevent.d1": gate},
+	}
+	b := New("ari.", m, log15.New())
+
+	s1 := b.Subscribe(ari.NewKey("", "", ari.WithApp("test")), ari.Events.All)
+	defer s1.Cancel()
+
+	// Subscribe to another subject, whose MessageBus subscription is held up
+	subscribed := make(chan struct{})
+	go func() {
+		s2 := b.Subscribe(ari.NewKey("", "", ari.WithDialog("d1")), ari.Events.All)
+		s2.Cancel()
+		close(subscribed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	delivered := make(chan struct{})
+	go func() {
+		m.mu.Lock()
+		h := m.handlers["ari.event.test.>"]
+		m.mu.Unlock()
+		h([]byte(`{"type":"StasisEnd","application":"test","channel":{"id":"c1"}}`))
+		close(delivered)
+	}()
+
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("event dispatch was blocked by a pending MessageBus subscription")
+	}
+	if len(s1.Events()) != 1 {
+		t.Error("event was not delivered")
+	}
+
+	close(gate)
+	<-subscribed
+	if b.mux.Subjects() != 1 {
+		t.Errorf("unexpected subject count %d", b.mux.Subjects())
+	}
+}
@@ -0,0 +1,158 @@
+package bus
+
+import (
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultBlockTimeout is the maximum amount of time for which delivery waits
+// for room in the buffer of a Subscription under the OverflowBlock policy, if
+// the Subscription does not set its own BlockTimeout.  Since a Subscription
+// shares its MessageBus subscription with others, delivery to all of them
+// waits on it meanwhile.
+var DefaultBlockTimeout = time.Second
+
+// ErrOverflow indicates that a Subscription was closed because its event
+// buffer overflowed
+var ErrOverflow = eris.New("subscription event buffer overflowed")
+
+// OverflowPolicy describes what a Subscription does with an event when its
+// event buffer is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the buffer, for at most the
+	// BlockTimeout of the Subscription, after which the event is dropped.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest buffered event to make room for the new one
+	OverflowDropOldest
+
+	// OverflowDropNewest drops the new event
+	OverflowDropNewest
+
+	// OverflowClose drops the new event and cancels the Subscription, whose
+	// Err method then returns ErrOverflow
+	OverflowClose
+)
+
+// OverflowHandler is called with each event which a Subscription drops.  It
+// is called from the MessageBus delivery path and should not block.
+type OverflowHandler func(s *Subscription, e ari.Event)
+
+// SubscriptionOptions describes the event buffering and sequence checking of a
+// Subscription
+type SubscriptionOptions struct {
+	// BufferSize is the number of events which may be buffered for the
+	// Subscription.  It defaults to EventChanBufferLength.
+	BufferSize int
+
+	// Policy describes what is done with events when the buffer is full
+	Policy OverflowPolicy
+
+	// BlockTimeout is the maximum amount of time to wait for room in the
+	// buffer under the OverflowBlock policy.  If it is zero, the
+	// DefaultBlockTimeout applies.  If it is negative, there is no limit, and
+	// a slow consumer stalls the delivery of events to every Subscription.
+	BlockTimeout time.Duration
+
+	// OnOverflow, if set, is called with each event which is dropped
+	OnOverflow OverflowHandler
+
+	// OnSequenceGap, if set, is called with each SequenceGap detected in the
+	// events received for the Subscription
+	OnSequenceGap SequenceGapHandler
+
+	// Sequenced delivers the events received from the ARI proxies as
+	// *proxy.SequencedEvent, carrying their position in the event stream of
+	// their proxy, rather than as the bare events
+	Sequenced bool
+}
+
+// WithSubscriptionOptions configures the options of the Subscriptions made by
+// the Bus's Subscribe method
+func WithSubscriptionOptions(o SubscriptionOptions) Option {
+	return func(b *Bus) {
+		b.subOpts = o
+	}
+}
+
+// Dropped returns the number of events which the Subscription has dropped
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Err returns the error which caused the Subscription to be closed, if any
+func (s *Subscription) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.err
+}
+
+// send places the event in the event buffer, applying the overflow policy if
+// the buffer is full.  It returns true if an event was dropped.
+func (s *Subscription) send(e ari.Event) bool {
+	select {
+	case s.eventChan <- e:
+		return false
+	case <-s.done:
+		return false
+	default:
+	}
+
+	switch s.opts.Policy {
+	case OverflowDropOldest:
+		for {
+			select {
+			case old := <-s.eventChan:
+				s.drop(old)
+			default:
+			}
+
+			select {
+			case s.eventChan <- e:
+				return true
+			case <-s.done:
+				return true
+			default:
+			}
+		}
+	case OverflowDropNewest, OverflowClose:
+		s.drop(e)
+		return true
+	default:
+		wait := s.opts.BlockTimeout
+		if wait == 0 {
+			wait = DefaultBlockTimeout
+		}
+
+		var timeout <-chan time.Time
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			defer t.Stop()
+			timeout = t.C
+		}
+
+		select {
+		case s.eventChan <- e:
+			return false
+		case <-s.done:
+			return false
+		case <-timeout:
+			s.drop(e)
+			return true
+		}
+	}
+}
+
+// drop records the dropping of the event
+func (s *Subscription) drop(e ari.Event) {
+	s.dropped.Add(1)
+
+	if s.opts.OnOverflow != nil {
+		s.opts.OnOverflow(s, e)
+	}
+}
@@ -0,0 +1,118 @@
+package bus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func overflowTest(t *testing.T, o SubscriptionOptions, count int) (*Subscription, []string) {
+	m := &testMessageBus{handlers: make(map[string]messagebus.EventHandler)}
+	b := New("ari.", m, log15.New())
+
+	var dropped []string
+	o.OnOverflow = func(s *Subscription, e ari.Event) {
+		dropped = append(dropped, e.(*ari.ChannelVarset).Variable)
+	}
+
+	s := b.SubscribeWithOptions(ari.NewKey("", "", ari.WithApp("test")), o, ari.Events.ChannelVarset)
+	if s == nil {
+		t.Fatal("failed to subscribe")
+	}
+
+	for i := 0; i < count; i++ {
+		m.handlers["ari.event.test.>"]([]byte(fmt.Sprintf(`{"type":"ChannelVarset","application":"test","variable":"v%d"}`, i)))
+	}
+	return s, dropped
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	s, dropped := overflowTest(t, SubscriptionOptions{BufferSize: 2, Policy: OverflowDropNewest}, 3)
+
+	if s.Dropped() != 1 || len(dropped) != 1 || dropped[0] != "v2" {
+		t.Errorf("unexpected drops: %d %v", s.Dropped(), dropped)
+	}
+	if e := <-s.Events(); e.(*ari.ChannelVarset).Variable != "v0" {
+		t.Error("oldest event should have been retained")
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	s, dropped := overflowTest(t, SubscriptionOptions{BufferSize: 2, Policy: OverflowDropOldest}, 3)
+
+	if s.Dropped() != 1 || len(dropped) != 1 || dropped[0] != "v0" {
+		t.Errorf("unexpected drops: %d %v", s.Dropped(), dropped)
+	}
+	if e := <-s.Events(); e.(*ari.ChannelVarset).Variable != "v1" {
+		t.Error("oldest event should have been dropped")
+	}
+}
+
+func TestOverflowBlockTimeout(t *testing.T) {
+	start := time.Now()
+	s, dropped := overflowTest(t, SubscriptionOptions{BufferSize: 1, BlockTimeout: 10 * time.Millisecond}, 2)
+
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("delivery did not block")
+	}
+	if s.Dropped() != 1 || len(dropped) != 1 || dropped[0] != "v1" {
+		t.Errorf("unexpected drops: %d %v", s.Dropped(), dropped)
+	}
+}
+
+func TestOverflowBlockDefaultTimeout(t *testing.T) {
+	defer func(d time.Duration) { DefaultBlockTimeout = d }(DefaultBlockTimeout)
+	DefaultBlockTimeout = 10 * time.Millisecond
+
+	s, dropped := overflowTest(t, SubscriptionOptions{BufferSize: 1}, 2)
+
+	if s.Dropped() != 1 || len(dropped) != 1 || dropped[0] != "v1" {
+		t.Errorf("unexpected drops: %d %v", s.Dropped(), dropped)
+	}
+}
+
+func TestOverflowClose(t *testing.T) {
+	s, _ := overflowTest(t, SubscriptionOptions{BufferSize: 1, Policy: OverflowClose}, 2)
+
+	if s.Err() != ErrOverflow {
+		t.Errorf("unexpected error: %v", s.Err())
+	}
+
+	var n int
+	for range s.Events() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("expected the buffered event before closure; got %d", n)
+	}
+}
+
+func TestCancelReleasesBlockedDelivery(t *testing.T) {
+	m := &testMessageBus{handlers: make(map[string]messagebus.EventHandler)}
+	b := New("ari.", m, log15.New(), WithSubscriptionOptions(SubscriptionOptions{BufferSize: 1}))
+
+	s := b.Subscribe(ari.NewKey("", "", ari.WithApp("test")), ari.Events.ChannelVarset)
+	h := m.handlers["ari.event.test.>"]
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2; i++ {
+			h([]byte(`{"type":"ChannelVarset","application":"test"}`))
+		}
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	s.Cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("blocked delivery was not released by Cancel")
+	}
+}
@@ -0,0 +1,153 @@
+package bus
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// SequenceGapEvent is the type of the synthetic SequenceGap event.  Since it
+// is not an ARI event, it is delivered only to Subscriptions which name it
+// explicitly, not to those for ari.Events.All.
+const SequenceGapEvent = "ProxySequenceGap"
+
+// GapKind describes a discontinuity in the event sequence of an ARI proxy
+type GapKind string
+
+const (
+	// GapMissed indicates that one or more events were not received
+	GapMissed GapKind = "missed"
+
+	// GapReboot indicates that the ARI proxy was restarted, so any events
+	// published between the last event of its previous run and the first of
+	// its new one may have been lost
+	GapReboot GapKind = "reboot"
+
+	// GapOutOfOrder indicates that an event arrived after a later one
+	GapOutOfOrder GapKind = "out_of_order"
+)
+
+// SequenceGap is a synthetic event which reports a discontinuity in the event
+// sequence of an ARI proxy (that is, of a node and application), so that the
+// recipient may resynchronize its state.  Sequences are checked only on the
+// subjects which carry the whole event stream of a proxy, so a SequenceGap is
+// reported to every Subscription on such a subject, regardless of the
+// entities to which it is limited.
+type SequenceGap struct {
+	ari.EventData
+
+	// Kind describes the discontinuity
+	Kind GapKind `json:"kind"`
+
+	// Expected is the sequence number which was expected
+	Expected uint64 `json:"expected"`
+
+	// Received is the sequence number which was received
+	Received uint64 `json:"received"`
+
+	// PreviousBoot identifies the previous run of the ARI proxy, when Kind is GapReboot
+	PreviousBoot string `json:"previous_boot,omitempty"`
+
+	// Boot identifies the run of the ARI proxy which published the received event
+	Boot string `json:"boot"`
+}
+
+// Keys implements ari.Event
+func (g *SequenceGap) Keys() ari.Keys {
+	return nil
+}
+
+// SequenceGapHandler is called with each SequenceGap reported to a
+// Subscription.  It is called from the MessageBus delivery path and should not
+// block.
+type SequenceGapHandler func(s *Subscription, g *SequenceGap)
+
+// streamKey identifies the event stream of an ARI proxy
+type streamKey struct {
+	node string
+	app  string
+}
+
+// sequenceTracker follows the event sequences of the ARI proxies whose events
+// are received on a subject
+type sequenceTracker struct {
+	last map[streamKey]proxy.EventSequence
+
+	mu sync.Mutex
+}
+
+func newSequenceTracker() *sequenceTracker {
+	return &sequenceTracker{
+		last: make(map[streamKey]proxy.EventSequence),
+	}
+}
+
+// check records the sequence of the event, returning a SequenceGap if it
+// does not follow the last one received from the same proxy
+func (t *sequenceTracker) check(e *proxy.SequencedEvent) *SequenceGap {
+	if e.Seq == 0 {
+		return nil
+	}
+
+	k := streamKey{node: e.GetNode(), app: e.GetApplication()}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, ok := t.last[k]
+	if !ok {
+		t.last[k] = e.EventSequence
+		return nil
+	}
+
+	gap := &SequenceGap{
+		EventData: ari.EventData{
+			Application: k.app,
+			Node:        k.node,
+			Timestamp:   ari.DateTime(time.Now()),
+			Type:        SequenceGapEvent,
+		},
+		Expected: last.Seq + 1,
+		Received: e.Seq,
+		Boot:     e.Boot,
+	}
+
+	switch {
+	case last.Boot != e.Boot:
+		gap.Kind = GapReboot
+		gap.PreviousBoot = last.Boot
+	case e.Seq == last.Seq+1:
+		t.last[k] = e.EventSequence
+		return nil
+	case e.Seq <= last.Seq:
+		gap.Kind = GapOutOfOrder
+		return gap
+	default:
+		gap.Kind = GapMissed
+	}
+
+	t.last[k] = e.EventSequence
+	return gap
+}
+
+// wants indicates whether the Subscription names the given event type explicitly
+func (s *Subscription) wants(eventType string) bool {
+	for _, t := range s.events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// reportGap surfaces the SequenceGap to the Subscription
+func (s *Subscription) reportGap(g *SequenceGap) {
+	if s.opts.OnSequenceGap != nil {
+		s.opts.OnSequenceGap(s, g)
+	}
+	if s.wants(SequenceGapEvent) {
+		s.deliver(g)
+	}
+}
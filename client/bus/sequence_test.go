@@ -0,0 +1,113 @@
+package bus
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func sequencedEvent(t *testing.T, boot string, seq uint64) []byte {
+	data, err := json.Marshal(&proxy.SequencedEvent{
+		Event: &ari.ChannelVarset{
+			EventData: ari.EventData{Type: "ChannelVarset", Application: "test", Node: "n1"},
+		},
+		EventSequence: proxy.EventSequence{Seq: seq, Boot: boot},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSequenceGaps(t *testing.T) {
+	m := &testMessageBus{handlers: make(map[string]messagebus.EventHandler)}
+	b := New("ari.", m, log15.New())
+
+	var gaps []*SequenceGap
+	s := b.SubscribeWithOptions(ari.NewKey("", "", ari.WithApp("test")), SubscriptionOptions{
+		BufferSize: 20,
+		OnSequenceGap: func(s *Subscription, g *SequenceGap) {
+			gaps = append(gaps, g)
+		},
+	}, ari.Events.ChannelVarset, SequenceGapEvent)
+
+	h := m.handlers["ari.event.test.>"]
+	for _, seq := range []uint64{1, 2, 5, 4} {
+		h(sequencedEvent(t, "b1", seq))
+	}
+	h(sequencedEvent(t, "b2", 1))
+
+	if len(gaps) != 3 {
+		t.Fatalf("expected 3 gaps; got %d", len(gaps))
+	}
+	if g := gaps[0]; g.Kind != GapMissed || g.Expected != 3 || g.Received != 5 {
+		t.Errorf("unexpected missed gap: %+v", g)
+	}
+	if g := gaps[1]; g.Kind != GapOutOfOrder || g.Received != 4 {
+		t.Errorf("unexpected out-of-order gap: %+v", g)
+	}
+	if g := gaps[2]; g.Kind != GapReboot || g.PreviousBoot != "b1" || g.Boot != "b2" {
+		t.Errorf("unexpected reboot gap: %+v", g)
+	}
+
+	var events, synthetic int
+	for len(s.Events()) > 0 {
+		e := <-s.Events()
+		if _, ok := e.(*SequenceGap); ok {
+			synthetic++
+			continue
+		}
+		if _, ok := e.(*ari.ChannelVarset); !ok {
+			t.Errorf("sequenced event was not unwrapped: %T", e)
+		}
+		events++
+	}
+	if events != 5 || synthetic != 3 {
+		t.Errorf("unexpected deliveries: %d events, %d gaps", events, synthetic)
+	}
+}
+
+// sharedQueueMessageBus divides the events of a queue among its subscribers
+type sharedQueueMessageBus struct {
+	*testMessageBus
+}
+
+func (sharedQueueMessageBus) SharedEventQueues() bool { return true }
+
+func TestSequenceSharedQueue(t *testing.T) {
+	m := sharedQueueMessageBus{&testMessageBus{handlers: make(map[string]messagebus.EventHandler)}}
+	b := New("ari.", m, log15.New())
+
+	var gaps int
+	s := b.SubscribeWithOptions(ari.NewKey("", "", ari.WithApp("test")), SubscriptionOptions{
+		OnSequenceGap: func(s *Subscription, g *SequenceGap) {
+			gaps++
+		},
+	}, ari.Events.ChannelVarset)
+	defer s.Cancel()
+
+	// The events in between were received by other consumers of the queue
+	h := m.handlers["ari.event.test.>"]
+	for _, seq := range []uint64{1, 3, 6} {
+		h(sequencedEvent(t, "b1", seq))
+	}
+
+	if gaps != 0 {
+		t.Errorf("expected no gaps on a shared queue; got %d", gaps)
+	}
+}
+
+func TestSequencedEventEncoding(t *testing.T) {
+	se, err := proxy.DecodeSequencedEvent(sequencedEvent(t, "b1", 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if se.Seq != 7 || se.Boot != "b1" || se.GetType() != "ChannelVarset" || se.GetNode() != "n1" {
+		t.Errorf("unexpected decoded event: %+v", se)
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"time"
 
@@ -10,7 +11,9 @@ import (
 	"github.com/CyCoreSystems/ari-proxy/v5/client/cluster"
 	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/session"
 	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
 	"github.com/rabbitmq/amqp091-go"
 	"github.com/rotisserie/eris"
 
@@ -42,6 +45,9 @@ var DefaultClusterMaxAge = 5 * time.Minute
 // ErrNil indicates that the request returned an empty response
 var ErrNil = eris.New("Nil")
 
+// ErrUnsupported indicates that the ARI proxies do not support a request
+var ErrUnsupported = eris.New("not supported by the ARI proxy")
+
 // core is the core, functional piece of a Client which is the same across the
 // family of derived clients.  It manages stateful elements such as the bus,
 // the MessageBus connection, and the cluster membership
@@ -49,9 +55,17 @@ type core struct {
 	// cluster describes the cluster of ARI proxies
 	cluster *cluster.Cluster
 
+	// clientID identifies this client to the ARI proxy servers.  It is
+	// attached to each request and recorded in the servers' audit logs.
+	clientID string
+
 	// clusterMaxAge is the maximum age of cluster members to include in queries
 	clusterMaxAge time.Duration
 
+	// codec is the preferred codec in which requests are encoded.  It is used
+	// only while every proxy in the cluster supports it.
+	codec messagebus.Codec
+
 	// inputBufferLength is the size of the buffer for events coming in from MessageBus
 	inputBufferLength int
 
@@ -74,6 +88,17 @@ type core struct {
 	// timeoutRetries is the amount of times to retry on message bus timeout
 	timeoutRetries int
 
+	// mux multiplexes the event subscriptions of every Bus derived from the
+	// core over MessageBus
+	mux *bus.Mux
+
+	// subOpts are the buffering options of event subscriptions
+	subOpts bus.SubscriptionOptions
+
+	// typedEvents indicates that event subscriptions should be made to the
+	// typed event subjects
+	typedEvents bool
+
 	// uri provies the URI to which a Message Bus connection should be established. One
 	// of mbus or uri must be specified. This option may also be supplied by
 	// the `MESSAGEBUS_URL` environment variable.
@@ -125,6 +150,15 @@ func (c *core) close() {
 	c.mbus.Close()
 }
 
+// newBus returns a new event bus over the core's MessageBus connection
+func (c *core) newBus() *bus.Bus {
+	opts := []bus.Option{bus.WithMux(c.mux), bus.WithSubscriptionOptions(c.subOpts)}
+	if c.typedEvents {
+		opts = append(opts, bus.WithTypedSubjects())
+	}
+	return bus.New(c.prefix, c.mbus, c.log, opts...)
+}
+
 func (c *core) Start() error {
 	// increment the client reference counter
 	c.refCounter++
@@ -170,6 +204,8 @@ func (c *core) Start() error {
 		c.closeMBusOnClose = true
 	}
 
+	c.mux = bus.NewMux(c.mbus, c.log)
+
 	// Create and start the cluster
 	c.cluster = cluster.New()
 
@@ -186,7 +222,12 @@ func (c *core) Start() error {
 func (c *core) maintainCluster() (err error) {
 
 	c.annSub, err = c.mbus.SubscribeAnnounce(proxy.AnnouncementSubject(c.prefix), func(o *proxy.Announcement) {
-		c.cluster.Update(o.Node, o.Application)
+		c.cluster.Announce(o.Node, o.Application, cluster.Features{
+			Version:      o.Version,
+			Capabilities: o.Capabilities,
+			Codecs:       o.Codecs,
+		})
+		c.negotiateCodec()
 	})
 	if err != nil {
 		return eris.Wrap(err, "failed to listen to proxy announcements")
@@ -200,6 +241,23 @@ func (c *core) maintainCluster() (err error) {
 	return err
 }
 
+// negotiateCodec encodes requests in the preferred codec if every proxy in
+// the cluster supports it, and otherwise in JSON
+func (c *core) negotiateCodec() {
+	if c.codec == nil {
+		return
+	}
+
+	codec := c.codec
+	for _, m := range c.cluster.All(c.clusterMaxAge) {
+		if !m.SupportsCodec(codec.Name()) {
+			codec = messagebus.JSONCodec
+			break
+		}
+	}
+	c.mbus.SetCodec(codec)
+}
+
 // Client provides an ari.Client for an ari-proxy server
 type Client struct {
 	*core
@@ -210,6 +268,9 @@ type Client struct {
 
 	cancel context.CancelFunc
 
+	// dialog is the dialog to which this client is scoped, if any
+	dialog *session.Dialog
+
 	// closed indicates that this client has been closed and is no longer attached to a core
 	closed bool
 }
@@ -221,6 +282,7 @@ func New(ctx context.Context, opts ...OptionFunc) (*Client, error) {
 	c := &Client{
 		appName: os.Getenv("ARI_APPLICATION"),
 		core: &core{
+			clientID:          defaultClientID(),
 			cluster:           cluster.New(),
 			clusterMaxAge:     DefaultClusterMaxAge,
 			inputBufferLength: DefaultInputBufferLength,
@@ -234,6 +296,9 @@ func New(ctx context.Context, opts ...OptionFunc) (*Client, error) {
 	c.log.SetHandler(log15.DiscardHandler())
 
 	// Load environment-based configurations
+	if os.Getenv("ARI_CLIENT_ID") != "" {
+		c.core.clientID = os.Getenv("ARI_CLIENT_ID")
+	}
 	if os.Getenv("MESSAGEBUS_URL") != "" {
 		c.core.uri = os.Getenv("MESSAGEBUS_URL")
 	} else if os.Getenv("NATS_URI") != "" { //backward compatibility
@@ -252,7 +317,7 @@ func New(ctx context.Context, opts ...OptionFunc) (*Client, error) {
 	}
 
 	// Create the bus
-	c.bus = bus.New(c.core.prefix, c.core.mbus, c.core.log)
+	c.bus = c.core.newBus()
 
 	// Call Close whenever the context is closed
 	go func() {
@@ -281,7 +346,7 @@ func (c *Client) New(ctx context.Context) *Client {
 		appName: c.appName,
 		cancel:  cancel,
 		core:    c.core,
-		bus:     bus.New(c.core.prefix, c.core.mbus, c.core.log),
+		bus:     c.core.newBus(),
 	}
 }
 
@@ -314,6 +379,24 @@ func WithApplication(name string) OptionFunc {
 	}
 }
 
+// WithClientID configures the identity which the Client reports to the ARI
+// proxy servers.  It defaults to the hostname and process ID of the client and
+// may also be configured by the environment variable `ARI_CLIENT_ID`.
+func WithClientID(id string) OptionFunc {
+	return func(c *Client) {
+		c.core.clientID = id
+	}
+}
+
+// defaultClientID returns the default client identity, composed of the hostname and process ID
+func defaultClientID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
 // WithLogger sets the logger on a Client.
 func WithLogger(l log15.Logger) OptionFunc {
 	return func(c *Client) {
@@ -370,6 +453,33 @@ func WithTimeoutRetries(count int) OptionFunc {
 	}
 }
 
+// WithCodec configures the Client to encode its requests in the given codec,
+// such as messagebus.MsgpackCodec, whenever every ARI proxy in the cluster
+// announces support for it.  Requests are otherwise encoded as JSON.
+func WithCodec(codec messagebus.Codec) OptionFunc {
+	return func(c *Client) {
+		c.core.codec = codec
+	}
+}
+
+// WithTypedEvents configures the Client to subscribe to the typed event
+// subjects, so that events are filtered by type and entity within the
+// MessageBus.  The ARI proxy servers must be configured to publish typed
+// event subjects.
+func WithTypedEvents() OptionFunc {
+	return func(c *Client) {
+		c.core.typedEvents = true
+	}
+}
+
+// WithSubscriptionOptions configures the buffer size and overflow policy of
+// the Client's event subscriptions.  See bus.SubscriptionOptions.
+func WithSubscriptionOptions(o bus.SubscriptionOptions) OptionFunc {
+	return func(c *Client) {
+		c.core.subOpts = o
+	}
+}
+
 // ApplicationName returns the ARI application's name
 func (c *Client) ApplicationName() string {
 	return c.appName
@@ -395,6 +505,12 @@ func (c *Client) Close() {
 		c.cancel()
 	}
 
+	if c.dialog != nil && !c.closed {
+		if err := c.dialog.Close(); err != nil {
+			c.log.Warn("failed to close dialog", "dialog", c.dialog.ID, "error", err)
+		}
+	}
+
 	if c.bus != nil {
 		c.bus.Close()
 	}
@@ -467,7 +583,7 @@ func (c *Client) StoredRecording() ari.StoredRecording {
 
 // TextMessage is the text message accessor
 func (c *Client) TextMessage() ari.TextMessage {
-	return nil
+	return &textMessage{c}
 }
 
 func (c *Client) commandRequest(req *proxy.Request) error {
@@ -539,6 +655,28 @@ func (c *Client) listRequest(req *proxy.Request) ([]*ari.Key, error) {
 }
 
 func (c *Client) makeRequest(class string, req *proxy.Request) (*proxy.Response, error) {
+	if c.dialog != nil {
+		return c.dialog.Command(class, req)
+	}
+	return c.request(class, req)
+}
+
+// request sends the given request, without regard to any dialog
+func (c *Client) request(class string, req *proxy.Request) (*proxy.Response, error) {
+	if req != nil {
+		if err := c.checkCapability(req); err != nil {
+			return nil, err
+		}
+		req.Version = proxy.ProtocolVersion
+		req.Client = c.core.clientID
+
+		// The idempotency key must remain the same across retries of the same
+		// request, so it is only assigned if it is not already set.
+		if req.IdempotencyKey == "" {
+			req.IdempotencyKey = rid.New("rq")
+		}
+	}
+
 	if !c.completeCoordinates(req) {
 		return c.makeBroadcastRequestReturnFirstGoodResponse(class, req)
 	}
@@ -554,6 +692,14 @@ func (c *Client) makeRequests(class string, req *proxy.Request) (responses []*pr
 	if req.Key == nil {
 		req.Key = ari.NewKey("", "")
 	}
+	if c.dialog != nil {
+		req.Key = c.dialog.Key(req.Key)
+	}
+	if err := c.checkCapability(req); err != nil {
+		return nil, err
+	}
+	req.Version = proxy.ProtocolVersion
+	req.Client = c.core.clientID
 
 	expected := len(c.core.cluster.Matching(req.Key.Node, req.Key.App, c.core.clusterMaxAge))
 
@@ -576,6 +722,47 @@ func (c *Client) makeBroadcastRequestReturnFirstGoodResponse(class string, req *
 	)
 }
 
+// checkCapability returns ErrUnsupported if none of the known ARI proxies to
+// which the request may be sent supports its kind.  Requests are sent
+// regardless while no proxy is known.
+func (c *Client) checkCapability(req *proxy.Request) error {
+	capability := proxy.RequiredCapability(req.Kind)
+	if capability == "" {
+		return nil
+	}
+
+	var node, app string
+	if req.Key != nil {
+		node, app = req.Key.Node, req.Key.App
+	}
+	if app == "" {
+		app = c.appName
+	}
+
+	members := c.core.cluster.Matching(node, app, c.core.clusterMaxAge)
+	for _, m := range members {
+		if m.Supports(capability) {
+			return nil
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return eris.Wrapf(ErrUnsupported, "%s requests require the %q capability", req.Kind, capability)
+}
+
+// Supports indicates whether every known ARI proxy of the Client's
+// application announced the given capability (see proxy.Capabilities).  It
+// is true while no proxy is known.
+func (c *Client) Supports(capability string) bool {
+	for _, m := range c.core.cluster.App(c.appName, c.core.clusterMaxAge) {
+		if !m.Supports(capability) {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Client) completeCoordinates(req *proxy.Request) bool {
 	if req == nil || req.Key == nil {
 		return false
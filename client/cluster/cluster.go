@@ -18,13 +18,17 @@ type Cluster struct {
 
 	members map[string]time.Time
 
+	// features holds the protocol features announced by each member
+	features map[string]Features
+
 	mu sync.Mutex
 }
 
 // New returns a new Cluster
 func New() *Cluster {
 	return &Cluster{
-		members: make(map[string]time.Time),
+		members:  make(map[string]time.Time),
+		features: make(map[string]Features),
 	}
 }
 
@@ -52,6 +56,49 @@ type Member struct {
 
 	// LastActive is the timestamp of the last occurrence of this node
 	LastActive time.Time
+
+	// Features are the protocol features of this proxy, as it last announced
+	// them
+	Features
+}
+
+// Features describes the protocol features announced by a proxy.  Proxies
+// which predate protocol versioning have no features.
+type Features struct {
+	// Version is the protocol version of the proxy
+	Version int
+
+	// Capabilities lists the optional features of the protocol which the
+	// proxy supports
+	Capabilities []string
+
+	// Codecs lists the names of the codecs in which the proxy accepts
+	// requests
+	Codecs []string
+}
+
+// Supports indicates whether the proxy announced the given capability
+func (f Features) Supports(capability string) bool {
+	for _, c := range f.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsCodec indicates whether the proxy accepts requests in the named
+// codec.  Every proxy accepts JSON.
+func (f Features) SupportsCodec(name string) bool {
+	if name == "" || name == "json" {
+		return true
+	}
+	for _, c := range f.Codecs {
+		if c == name {
+			return true
+		}
+	}
+	return false
 }
 
 // All returns a list of all cluster members whose LastActive time is no older thatn the given maxAge.
@@ -66,6 +113,7 @@ func (c *Cluster) All(maxAge time.Duration) (list []Member) {
 				ID:         id,
 				App:        app,
 				LastActive: v,
+				Features:   c.features[k],
 			})
 		}
 	}
@@ -84,6 +132,7 @@ func (c *Cluster) App(app string, maxAge time.Duration) (list []Member) {
 				ID:         i,
 				App:        a,
 				LastActive: v,
+				Features:   c.features[k],
 			})
 		}
 	}
@@ -111,6 +160,7 @@ func (c *Cluster) Matching(id, app string, maxAge time.Duration) (list []Member)
 			ID:         i,
 			App:        a,
 			LastActive: v,
+			Features:   c.features[k],
 		})
 	}
 	return
@@ -118,8 +168,15 @@ func (c *Cluster) Matching(id, app string, maxAge time.Duration) (list []Member)
 
 // Update adds (or updates) a proxy to/in the cluster
 func (c *Cluster) Update(id, app string) {
+	c.Announce(id, app, Features{})
+}
+
+// Announce adds (or updates) a proxy to/in the cluster, along with the
+// protocol features it announced
+func (c *Cluster) Announce(id, app string, f Features) {
 	c.mu.Lock()
 	c.members[hash(id, app)] = time.Now()
+	c.features[hash(id, app)] = f
 	c.mu.Unlock()
 
 	// See if it is time to auto-purge
@@ -145,5 +202,6 @@ func (c *Cluster) Purge(maxAge time.Duration) {
 
 	for _, key := range removalKeys {
 		delete(c.members, key)
+		delete(c.features, key)
 	}
 }
@@ -107,3 +107,34 @@ func TestPurge(t *testing.T) {
 		t.Errorf("Incorrect number of cluster members: %d != 2", len(list))
 	}
 }
+
+func TestAnnounce(t *testing.T) {
+	c := New()
+	c.Update("A1", "TestApp")
+	c.Announce("A2", "TestApp", Features{
+		Version:      1,
+		Capabilities: []string{"batch"},
+		Codecs:       []string{"json", "msgpack"},
+	})
+
+	for _, m := range c.App("TestApp", 0) {
+		switch m.ID {
+		case "A1":
+			if m.Version != 0 || m.Supports("batch") || m.SupportsCodec("msgpack") {
+				t.Errorf("Unexpected features of an unversioned member: %+v", m.Features)
+			}
+			if !m.SupportsCodec("json") {
+				t.Error("Every member should support JSON")
+			}
+		case "A2":
+			if m.Version != 1 || !m.Supports("batch") || m.Supports("snapshot") || !m.SupportsCodec("msgpack") {
+				t.Errorf("Unexpected features: %+v", m.Features)
+			}
+		}
+	}
+
+	c.Update("A2", "TestApp")
+	if m := c.Matching("A2", "TestApp", time.Minute); len(m) != 1 || m[0].Supports("batch") {
+		t.Errorf("Features should be replaced by each update: %+v", m)
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// DialogManager provides access to the dialog bindings held by the ARI proxies
+type DialogManager struct {
+	c *Client
+}
+
+// DialogManager returns the dialog manager accessor
+func (c *Client) DialogManager() *DialogManager {
+	return &DialogManager{c}
+}
+
+// List returns the IDs of all dialogs which are bound to at least one entity
+func (m *DialogManager) List() ([]string, error) {
+	list, err := m.c.listRequest(&proxy.Request{
+		Kind: "DialogList",
+		Key:  ari.NewKey(proxy.DialogKey, "", ari.WithApp(m.c.appName)),
+	})
+
+	seen := make(map[string]bool)
+	var ret []string
+	for _, k := range list {
+		if !seen[k.ID] {
+			seen[k.ID] = true
+			ret = append(ret, k.ID)
+		}
+	}
+	return ret, err
+}
+
+// Bindings returns the keys of the entities which are bound to the given dialog
+func (m *DialogManager) Bindings(dialog string) ([]*ari.Key, error) {
+	if dialog == "" {
+		return nil, eris.New("dialog is mandatory")
+	}
+
+	list, err := m.c.listRequest(&proxy.Request{
+		Kind: "DialogBindings",
+		Key:  ari.NewKey(proxy.DialogKey, dialog, ari.WithApp(m.c.appName), ari.WithDialog(dialog)),
+	})
+
+	seen := make(map[string]bool)
+	var ret []*ari.Key
+	for _, k := range list {
+		if h := k.Kind + ":" + k.ID; !seen[h] {
+			seen[h] = true
+			ret = append(ret, k)
+		}
+	}
+	return ret, err
+}
+
+// Bind binds the given dialog to the entity identified by the given key, so
+// that events for the entity are delivered to the dialog
+func (m *DialogManager) Bind(dialog string, key *ari.Key) error {
+	if dialog == "" || key == nil {
+		return eris.New("dialog and key are mandatory")
+	}
+
+	return m.c.commandRequest(&proxy.Request{
+		Kind: "DialogBind",
+		Key:  ari.NewKey(key.Kind, key.ID, ari.WithLocationOf(key), ari.WithDialog(dialog)),
+	})
+}
+
+// Unbind removes the binding of the given dialog to the entity identified by
+// the given key.  If dialog is empty, the entity is unbound from all dialogs.
+func (m *DialogManager) Unbind(dialog string, key *ari.Key) error {
+	if key == nil {
+		return eris.New("key is mandatory")
+	}
+
+	return m.c.commandRequest(&proxy.Request{
+		Kind: "DialogUnbind",
+		Key:  ari.NewKey(key.Kind, key.ID, ari.WithLocationOf(key), ari.WithDialog(dialog)),
+	})
+}
+
+// Close removes all bindings of the given dialog
+func (m *DialogManager) Close(dialog string) error {
+	if dialog == "" {
+		return eris.New("dialog is mandatory")
+	}
+
+	return m.c.commandRequest(&proxy.Request{
+		Kind: "DialogClose",
+		Key:  ari.NewKey(proxy.DialogKey, dialog, ari.WithApp(m.c.appName), ari.WithDialog(dialog)),
+	})
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// EventFilters returns the event filters of the ARI proxies matching the given
+// key, along with the number of events each has withheld from its canonical
+// event subject.  The key of each response identifies its proxy.
+func (c *Client) EventFilters(key *ari.Key) ([]*proxy.Response, error) {
+	if key == nil {
+		key = ari.NewKey("", "", ari.WithApp(c.appName))
+	}
+
+	return c.makeRequests("data", &proxy.Request{
+		Kind: "EventFilter",
+		Key:  key,
+	})
+}
+
+// SetEventFilter sets the event types which the ARI proxies matching the given
+// key publish to their canonical event subjects.  If allow is empty, all event
+// types which are not denied are published.  Events are always published to
+// their dialogs.  Any entity filtering of the proxies is removed.
+func (c *Client) SetEventFilter(key *ari.Key, allow, deny []string) error {
+	return c.SetEventFilterRule(key, &proxy.EventFilter{
+		Allow: allow,
+		Deny:  deny,
+	})
+}
+
+// SetEventFilterRule replaces the filter by which the ARI proxies matching the
+// given key select, by type and by the entities they concern, the events which
+// they publish to their canonical event subjects.  Events are always published
+// to their dialogs.
+func (c *Client) SetEventFilterRule(key *ari.Key, rule *proxy.EventFilter) error {
+	if key == nil {
+		key = ari.NewKey("", "", ari.WithApp(c.appName))
+	}
+
+	return c.commandRequest(&proxy.Request{
+		Kind:        "EventFilterSet",
+		Key:         key,
+		EventFilter: rule,
+	})
+}
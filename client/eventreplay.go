@@ -0,0 +1,48 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// ReplayEvents requests the recent events of the ARI proxy identified by the
+// given key, which should include the node, as selected by the given replay
+// request.  The events are returned in order along with their sequence,
+// unless they were re-published to the requested subject.  The result
+// describes the events which the proxy holds, and whether any requested
+// events had already been discarded.
+//
+// Sequence numbers are only meaningful within a single run of the proxy, so
+// the Boot of the result should be compared to that of the last event
+// received.
+func (c *Client) ReplayEvents(key *ari.Key, r *proxy.EventReplay) ([]*proxy.SequencedEvent, *proxy.EventReplayResult, error) {
+	if key == nil {
+		key = ari.NewKey("", "", ari.WithApp(c.appName))
+	}
+
+	resp, err := c.makeRequest("data", &proxy.Request{
+		Kind:        "EventReplay",
+		Key:         key,
+		EventReplay: r,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.Err() != nil {
+		return nil, nil, resp.Err()
+	}
+	if resp.EventReplay == nil {
+		return nil, nil, ErrNil
+	}
+
+	ret := make([]*proxy.SequencedEvent, 0, len(resp.EventReplay.Events))
+	for _, data := range resp.EventReplay.Events {
+		e, err := proxy.DecodeSequencedEvent(data)
+		if err != nil {
+			return nil, nil, eris.Wrap(err, "failed to decode replayed event")
+		}
+		ret = append(ret, e)
+	}
+	return ret, resp.EventReplay, nil
+}
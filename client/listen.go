@@ -2,16 +2,20 @@ package client
 
 import (
 	"context"
-	"fmt"
+	"time"
 
-	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
-	"github.com/rotisserie/eris"
 )
 
 // ListenQueue is the queue group to use for distributing StasisStart events to Listeners.
 var ListenQueue = "ARIProxyStasisStartDistributorQueue"
 
+// ListenerAnnounceInterval is the interval at which Listeners announce their
+// presence to the ARI proxies, which may apply a fallback to the channels
+// which enter Stasis while no listener is present.
+var ListenerAnnounceInterval = 10 * time.Second
+
 // Listen listens for StasisStart events, filtered by the given key.  Any
 // matching events will be sent down the returned StasisStart channel.  The
 // context which is passed to Listen can be used to stop the Listen execution.
@@ -19,50 +23,55 @@ var ListenQueue = "ARIProxyStasisStartDistributorQueue"
 // Importantly, the StasisStart events are listened in a NATS/RabbitMQ Queue, which
 // means that this may be used to deliver new calls to only a single handler
 // out of a set of 1 or more handlers in a cluster.
+//
+// The handler is called within the subscription, one event at a time.  The
+// channels which an ARI proxy offers to be claimed (see ListenClaimed) are
+// claimed before being passed to the handler, in place of their StasisStart
+// events.
 func Listen(ctx context.Context, ac ari.Client, h func(*ari.ChannelHandle, *ari.StasisStart)) error {
-	c, ok := ac.(*Client)
-	if !ok {
-		return eris.New("ARI Client must be a proxy client")
-	}
-
-	subj := fmt.Sprintf(
-		"%sevent.%s.%s",
-		c.core.prefix,
-		c.ApplicationName(),
-		c.mbus.GetWildcardString(messagebus.WildcardZeroOrMoreWords),
-	)
-
-	c.log.Debug("listening for events", "subject", subj)
-	sub, err := c.mbus.SubscribeEvent(subj, ListenQueue, listenProcessor(ac, h))
-	if err != nil {
-		return eris.Wrap(err, "failed to subscribe to events")
-	}
-	defer sub.Unsubscribe() // nolint: errcheck
-
-	<-ctx.Done()
+	return listen(ctx, ac, h, &ListenOptions{}, true)
+}
 
-	return nil
+// ListenClaimed listens for the channels which the ARI proxies offer to be
+// claimed as they enter Stasis (see the ClaimTimeout of the proxy server).
+// Each offer is delivered to a single listener out of the queue group, which
+// claims the channel before passing it to the handler.  A channel which is not
+// claimed in time, for instance because its listener has failed, is offered
+// again, possibly to a different listener, until the proxy gives up and
+// applies its fallback.  Unlike Listen, ListenClaimed handles only the offered
+// channels, and it fails unless every ARI proxy offers claims.  The context
+// which is passed to ListenClaimed can be used to stop its execution.
+func ListenClaimed(ctx context.Context, ac ari.Client, h func(*ari.ChannelHandle, *ari.StasisStart)) error {
+	return ListenWithOptions(ctx, ac, h, &ListenOptions{Claim: true})
 }
 
-func listenProcessor(ac ari.Client, h func(*ari.ChannelHandle, *ari.StasisStart)) func([]byte) {
-	return func(data []byte) {
-		e, err := ari.DecodeEvent(data)
-		if err != nil {
-			Logger.Error("failed to decode event", "error", err)
-			return
-		}
+// announceListener announces the presence of a listener for the client's
+// application, periodically, until the context is closed
+func (c *Client) announceListener(ctx context.Context) {
+	ticker := time.NewTicker(ListenerAnnounceInterval)
+	defer ticker.Stop()
 
-		Logger.Debug("received event", e.GetType())
-		if e.GetType() != "StasisStart" {
-			return
+	subj := proxy.ListenerSubject(c.core.prefix, c.ApplicationName())
+	for {
+		if err := c.mbus.PublishPing(subj); err != nil {
+			c.log.Warn("failed to announce listener", "error", err)
 		}
 
-		v, ok := e.(*ari.StasisStart)
-		if !ok {
-			Logger.Error("failed to type-assert StasisStart event")
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
 		}
-
-		h(ari.NewChannelHandle(v.Key(ari.ChannelKey, v.Channel.ID), ac.Channel(), nil), v)
 	}
 }
+
+// claimChannel claims the offered channel with the given key
+func (c *Client) claimChannel(key *ari.Key, token string) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "ChannelClaim",
+		Key:  key,
+		ChannelClaim: &proxy.ChannelClaim{
+			Token: token,
+		},
+	})
+}
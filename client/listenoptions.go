@@ -0,0 +1,419 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// ListenResubscribeInterval is the interval at which a listener which failed
+// to resume consuming events retries
+var ListenResubscribeInterval = time.Second
+
+// ClaimQueueSuffix is appended to the queue group of a listener to form the
+// queue group in which it consumes the offers of channels
+var ClaimQueueSuffix = "_claims"
+
+// ListenOptions describes the StasisStart events which ListenWithOptions
+// handles and how it handles them
+type ListenOptions struct {
+	// Args, if set, limits the listener to the channels whose Stasis
+	// arguments begin with the given values
+	Args []string
+
+	// CallerID, if set, is a pattern (see path.Match) which the caller ID
+	// number of the channel must match
+	CallerID string
+
+	// Extension, if set, is a pattern (see path.Match) which the dialed
+	// extension of the channel must match
+	Extension string
+
+	// Filter, if set, is an additional test which the StasisStart event must pass
+	Filter func(*ari.StasisStart) bool
+
+	// Queue is the queue group of the listener.  Each event is delivered to a
+	// single member of each queue group, so listeners which handle different
+	// calls must use different queue groups.  It defaults to ListenQueue or,
+	// if any of Args, CallerID or Extension is set, to a queue group derived
+	// from them.  Filter is not taken into account, so listeners which differ
+	// only by their Filter should set distinct Queues.
+	Queue string
+
+	// MaxConcurrency, if positive, is the maximum number of handlers which may
+	// run at once.  It requires Claim.  Once it is reached, the listener
+	// declines the offers it receives, which are then made again to the other
+	// members of its queue group, and stops consuming them until a handler
+	// returns.
+	MaxConcurrency int
+
+	// Claim limits the listener to the channels which the ARI proxies offer
+	// to be claimed (see ListenClaimed), ignoring the StasisStart events
+	// which are not matched by an offer.  Offered channels are handled by
+	// every listener, whether or not Claim is set: each channel is claimed
+	// before being passed to the handler, and a channel which the listener
+	// does not take is offered again to another listener.
+	Claim bool
+}
+
+// ListenWithOptions listens for StasisStart events, like Listen, and runs the
+// handler, in its own goroutine, for each of those matching the options.  A
+// panic in the handler is recovered and logged.  The context which is passed
+// to ListenWithOptions can be used to stop its execution.
+func ListenWithOptions(ctx context.Context, ac ari.Client, h func(*ari.ChannelHandle, *ari.StasisStart), opts *ListenOptions) error {
+	return listen(ctx, ac, h, opts, false)
+}
+
+// listen listens for StasisStart events as specified by the options.  If
+// inline is set, the handler is run within the subscription's callback, as
+// Listen does.
+func listen(ctx context.Context, ac ari.Client, h func(*ari.ChannelHandle, *ari.StasisStart), opts *ListenOptions, inline bool) error {
+	c, ok := ac.(*Client)
+	if !ok {
+		return eris.New("ARI Client must be a proxy client")
+	}
+
+	if opts == nil {
+		opts = &ListenOptions{}
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if opts.Claim && !c.Supports(proxy.CapabilityClaims) {
+		return eris.Wrap(ErrUnsupported, "channel claims are not supported by every ARI proxy")
+	}
+
+	offers := proxy.ClaimSubject(
+		c.core.prefix,
+		c.ApplicationName(),
+		c.mbus.GetWildcardString(messagebus.WildcardOneWord),
+	)
+	events := c.listenSubject()
+	queue := opts.queue()
+
+	l := newListener(ctx, opts, c.Channel(), h, func(onEvent, onOffer messagebus.EventHandler) (messagebus.Subscription, error) {
+		return c.subscribeListener(events, offers, queue, opts.Claim, onEvent, onOffer)
+	})
+	l.claim = c.claimChannel
+	l.inline = inline
+
+	c.log.Debug("listening for channels", "events", events, "offers", offers, "queue", queue, "claim", opts.Claim)
+	if err := l.start(); err != nil {
+		return eris.Wrap(err, "failed to subscribe to events")
+	}
+	defer l.stop()
+
+	c.announceListener(ctx)
+
+	return nil
+}
+
+// listenSubject returns the subject of the StasisStart events of the
+// application: the typed subject of StasisStart events, from any node, if the
+// client uses the typed event subjects, or else the legacy event subject
+func (c *Client) listenSubject() string {
+	if c.core.typedEvents {
+		return fmt.Sprintf(
+			"%stypedevent.%s.%s.%s",
+			c.core.prefix,
+			proxy.EscapeSubjectToken(c.ApplicationName()),
+			c.mbus.GetWildcardString(messagebus.WildcardOneWord),
+			proxy.EscapeSubjectToken(ari.Events.StasisStart),
+		)
+	}
+	return fmt.Sprintf(
+		"%sevent.%s.%s",
+		c.core.prefix,
+		c.ApplicationName(),
+		c.mbus.GetWildcardString(messagebus.WildcardZeroOrMoreWords),
+	)
+}
+
+// subscribeListener subscribes to the offers of channels and, unless the
+// listener is limited to them, to the events of the application.  The offers
+// are consumed in a queue group of their own, so that a RabbitMQ queue is
+// never shared by both.
+func (c *Client) subscribeListener(events, offers, queue string, claimOnly bool, onEvent, onOffer messagebus.EventHandler) (messagebus.Subscription, error) {
+	var subs listenSubscription
+
+	sub, err := c.mbus.SubscribeQueue(offers, queue+ClaimQueueSuffix, onOffer)
+	if err != nil {
+		return nil, err
+	}
+	subs = append(subs, sub)
+
+	if !claimOnly {
+		sub, err := c.mbus.SubscribeQueue(events, queue, onEvent)
+		if err != nil {
+			subs.Unsubscribe() // nolint: errcheck
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+// listenSubscription holds the subscriptions of a listener
+type listenSubscription []messagebus.Subscription
+
+// Unsubscribe implements messagebus.Subscription
+func (s listenSubscription) Unsubscribe() error {
+	var ret error
+	for _, sub := range s {
+		if err := sub.Unsubscribe(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+func (o *ListenOptions) validate() error {
+	if o.MaxConcurrency > 0 && !o.Claim {
+		return eris.New("MaxConcurrency requires Claim")
+	}
+	for _, p := range []string{o.CallerID, o.Extension} {
+		if _, err := path.Match(p, ""); err != nil {
+			return eris.Wrapf(err, "invalid pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// queue returns the queue group of the listener
+func (o *ListenOptions) queue() string {
+	if o.Queue != "" {
+		return o.Queue
+	}
+	if len(o.Args) == 0 && o.CallerID == "" && o.Extension == "" {
+		return ListenQueue
+	}
+
+	data, _ := json.Marshal([]interface{}{o.Args, o.CallerID, o.Extension}) // nolint: errcheck
+	sum := sha256.Sum256(data)
+	return ListenQueue + "_" + hex.EncodeToString(sum[:8])
+}
+
+// match indicates whether the listener handles the given event
+func (o *ListenOptions) match(e *ari.StasisStart) bool {
+	if len(e.Args) < len(o.Args) {
+		return false
+	}
+	for i, a := range o.Args {
+		if e.Args[i] != a {
+			return false
+		}
+	}
+
+	if !matchPattern(o.CallerID, e.Channel.GetCaller().GetNumber()) {
+		return false
+	}
+	if !matchPattern(o.Extension, e.Channel.GetDialplan().GetExten()) {
+		return false
+	}
+
+	return o.Filter == nil || o.Filter(e)
+}
+
+// matchPattern indicates whether the value matches the pattern, if any
+func matchPattern(pattern, v string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, v)
+	return ok && err == nil
+}
+
+// listener consumes StasisStart events for ListenWithOptions, pausing its
+// subscription while it is at its MaxConcurrency
+type listener struct {
+	ctx       context.Context
+	opts      *ListenOptions
+	channel   ari.Channel
+	h         func(*ari.ChannelHandle, *ari.StasisStart)
+	subscribe func(onEvent, onOffer messagebus.EventHandler) (messagebus.Subscription, error)
+
+	// claim claims the offered channel with the given key and token
+	claim func(key *ari.Key, token string) error
+
+	// inline indicates that the handler is run within the subscription's
+	// callback, and that its panics are not recovered
+	inline bool
+
+	// slots holds a token for each running handler, if concurrency is limited
+	slots chan struct{}
+
+	sub     messagebus.Subscription
+	stopped bool
+	mu      sync.Mutex
+}
+
+func newListener(ctx context.Context, opts *ListenOptions, channel ari.Channel, h func(*ari.ChannelHandle, *ari.StasisStart), subscribe func(onEvent, onOffer messagebus.EventHandler) (messagebus.Subscription, error)) *listener {
+	l := &listener{
+		ctx:       ctx,
+		opts:      opts,
+		channel:   channel,
+		h:         h,
+		subscribe: subscribe,
+	}
+	if opts.MaxConcurrency > 0 {
+		l.slots = make(chan struct{}, opts.MaxConcurrency)
+	}
+	return l
+}
+
+func (l *listener) start() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sub, err := l.subscribe(l.processEvent, l.processOffer)
+	if err != nil {
+		return err
+	}
+	l.sub = sub
+	return nil
+}
+
+func (l *listener) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopped = true
+	if l.sub != nil {
+		l.sub.Unsubscribe() // nolint: errcheck
+		l.sub = nil
+	}
+}
+
+// processEvent handles an event received from the MessageBus.  The
+// StasisStart events whose channels are offered to be claimed are left to the
+// offers.
+func (l *listener) processEvent(data []byte) {
+	e, err := proxy.DecodeSequencedEvent(data)
+	if err != nil {
+		Logger.Error("failed to decode event", "error", err)
+		return
+	}
+
+	v, ok := e.Event.(*ari.StasisStart)
+	if !ok || e.Offered {
+		return
+	}
+	l.handle(v, "")
+}
+
+// processOffer handles the offer of a channel received from the MessageBus
+func (l *listener) processOffer(data []byte) {
+	o, err := proxy.DecodeStasisOffer(data)
+	if err != nil {
+		Logger.Error("failed to decode channel offer", "error", err)
+		return
+	}
+	l.handle(o.StasisStart, o.Token)
+}
+
+// handle runs the handler for the StasisStart event, if it matches, first
+// claiming its channel if it was offered with the given claim token
+func (l *listener) handle(e *ari.StasisStart, token string) {
+	if !l.opts.match(e) {
+		return
+	}
+
+	if !l.acquire() {
+		return
+	}
+
+	key := e.Key(ari.ChannelKey, e.Channel.ID)
+	if token != "" && l.claim != nil {
+		if err := l.claim(key, token); err != nil {
+			Logger.Debug("failed to claim channel", "channel", e.Channel.ID, "error", err)
+			l.release()
+			return
+		}
+	}
+
+	if l.inline {
+		l.h(ari.NewChannelHandle(key, l.channel, nil), e)
+		return
+	}
+	go l.run(key, e)
+}
+
+// run calls the handler, isolating the listener from its panics
+func (l *listener) run(key *ari.Key, e *ari.StasisStart) {
+	defer l.release()
+	defer func() {
+		if r := recover(); r != nil {
+			Logger.Error("listener handler panicked", "channel", e.Channel.ID, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+
+	l.h(ari.NewChannelHandle(key, l.channel, nil), e)
+}
+
+// acquire takes a handler slot, if one is free, without blocking the
+// subscription's callback.  It stops consuming offers when the last slot is
+// taken, dropping those which are pending, which are offered again.  It
+// returns false if no slot is free or if the listener was closed.
+func (l *listener) acquire() bool {
+	if l.slots == nil {
+		return true
+	}
+	if l.ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.slots) == cap(l.slots) && l.sub != nil {
+		// Unsubscribe asynchronously, since we are within the subscription's callback
+		go l.sub.Unsubscribe() // nolint: errcheck
+		l.sub = nil
+	}
+	return true
+}
+
+// release returns a handler slot, resuming the consumption of events
+func (l *listener) release() {
+	if l.slots == nil {
+		return
+	}
+	<-l.slots
+
+	l.resume()
+}
+
+func (l *listener) resume() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopped || l.sub != nil || len(l.slots) == cap(l.slots) {
+		return
+	}
+
+	sub, err := l.subscribe(l.processEvent, l.processOffer)
+	if err != nil {
+		Logger.Error("failed to resume listening", "error", err)
+		time.AfterFunc(ListenResubscribeInterval, l.resume)
+		return
+	}
+	l.sub = sub
+}
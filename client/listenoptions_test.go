@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func stasisStart(id string, number, exten string, args ...string) *ari.StasisStart {
+	return &ari.StasisStart{
+		EventData: ari.EventData{
+			Type:        "StasisStart",
+			Application: "test",
+		},
+		Args: args,
+		Channel: ari.ChannelData{
+			ID:       id,
+			Caller:   &ari.CallerID{Number: number},
+			Dialplan: &ari.DialplanCEP{Exten: exten},
+		},
+	}
+}
+
+func TestListenOptionsMatch(t *testing.T) {
+	e := stasisStart("ch1", "15555550100", "2000", "sales", "east")
+
+	tests := []struct {
+		name  string
+		opts  ListenOptions
+		match bool
+	}{
+		{"none", ListenOptions{}, true},
+		{"args", ListenOptions{Args: []string{"sales"}}, true},
+		{"all args", ListenOptions{Args: []string{"sales", "east"}}, true},
+		{"other args", ListenOptions{Args: []string{"support"}}, false},
+		{"too many args", ListenOptions{Args: []string{"sales", "east", "x"}}, false},
+		{"caller id", ListenOptions{CallerID: "1555*"}, true},
+		{"other caller id", ListenOptions{CallerID: "1666*"}, false},
+		{"extension", ListenOptions{Extension: "2???"}, true},
+		{"other extension", ListenOptions{Extension: "3*"}, false},
+		{"filter", ListenOptions{Filter: func(*ari.StasisStart) bool { return false }}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.match(e); got != tt.match {
+			t.Errorf("%s: expected match %v, got %v", tt.name, tt.match, got)
+		}
+	}
+
+	if (&ListenOptions{CallerID: "1555*"}).match(&ari.StasisStart{}) {
+		t.Error("expected channel without caller ID not to match")
+	}
+}
+
+func TestListenOptionsQueue(t *testing.T) {
+	if q := (&ListenOptions{}).queue(); q != ListenQueue {
+		t.Errorf("expected default queue %q, got %q", ListenQueue, q)
+	}
+	if q := (&ListenOptions{Queue: "mine", Args: []string{"a"}}).queue(); q != "mine" {
+		t.Errorf("expected explicit queue, got %q", q)
+	}
+
+	a := (&ListenOptions{Args: []string{"sales"}}).queue()
+	b := (&ListenOptions{Args: []string{"support"}}).queue()
+	if a == ListenQueue || a == b {
+		t.Errorf("expected distinct queues per filter, got %q and %q", a, b)
+	}
+	if a != (&ListenOptions{Args: []string{"sales"}}).queue() {
+		t.Error("expected queue to be stable for a filter")
+	}
+
+	if err := (&ListenOptions{CallerID: "["}).validate(); err == nil {
+		t.Error("expected invalid pattern to be rejected")
+	}
+	if err := (&ListenOptions{MaxConcurrency: 1}).validate(); err == nil {
+		t.Error("expected MaxConcurrency without Claim to be rejected")
+	}
+}
+
+type listenTestBus struct {
+	subscribes int
+	active     bool
+	mu         sync.Mutex
+}
+
+type listenTestSub struct {
+	b *listenTestBus
+}
+
+func (s *listenTestSub) Unsubscribe() error {
+	s.b.mu.Lock()
+	s.b.active = false
+	s.b.mu.Unlock()
+	return nil
+}
+
+func (b *listenTestBus) subscribe(messagebus.EventHandler, messagebus.EventHandler) (messagebus.Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribes++
+	b.active = true
+	return &listenTestSub{b: b}, nil
+}
+
+func (b *listenTestBus) state() (int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribes, b.active
+}
+
+func waitFor(t *testing.T, desc string, f func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", desc)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestListenerConcurrency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := &listenTestBus{}
+	unblock := make(chan struct{})
+	var handled sync.WaitGroup
+	h := func(h *ari.ChannelHandle, e *ari.StasisStart) {
+		defer handled.Done()
+		if e.Channel.ID == "panic" {
+			panic("handler failure")
+		}
+		<-unblock
+	}
+
+	var claimed []string
+	var claimMu sync.Mutex
+	l := newListener(ctx, &ListenOptions{MaxConcurrency: 2, Claim: true}, nil, h, bus.subscribe)
+	l.claim = func(key *ari.Key, token string) error {
+		claimMu.Lock()
+		claimed = append(claimed, key.ID)
+		claimMu.Unlock()
+		return nil
+	}
+	if err := l.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(id string) {
+		data, err := json.Marshal(&proxy.StasisOffer{
+			StasisStart: stasisStart(id, "", ""),
+			Claim:       proxy.Claim{Token: "t-" + id, Attempt: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.processOffer(data)
+	}
+
+	// A panicking handler must not take the listener down
+	handled.Add(1)
+	send("panic")
+	handled.Wait()
+
+	handled.Add(2)
+	send("ch1")
+	if _, active := bus.state(); !active {
+		t.Error("expected listener to be consuming below its limit")
+	}
+	send("ch2")
+	waitFor(t, "listener to pause", func() bool {
+		_, active := bus.state()
+		return !active
+	})
+
+	// An offer received while the listener is full is declined, without
+	// waiting, to be offered again
+	send("ch3")
+	claimMu.Lock()
+	if len(claimed) != 3 {
+		t.Errorf("expected the offer to be declined, got claims %v", claimed)
+	}
+	claimMu.Unlock()
+
+	close(unblock)
+	handled.Wait()
+	waitFor(t, "listener to resume", func() bool {
+		n, active := bus.state()
+		return active && n == 2
+	})
+
+	l.stop()
+	if _, active := bus.state(); active {
+		t.Error("expected listener to stop consuming")
+	}
+}
+
+func TestListenerOffers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handled := make(chan string, 3)
+	h := func(h *ari.ChannelHandle, e *ari.StasisStart) {
+		handled <- e.Channel.ID
+	}
+
+	var claimed []string
+	l := newListener(ctx, &ListenOptions{}, nil, h, (&listenTestBus{}).subscribe)
+	l.claim = func(key *ari.Key, token string) error {
+		claimed = append(claimed, key.ID+"/"+token)
+		return nil
+	}
+
+	encode := func(v interface{}) []byte {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// An offered channel is handled once, through its offer
+	l.processEvent(encode(&proxy.SequencedEvent{
+		Event:         stasisStart("ch1", "", ""),
+		EventSequence: proxy.EventSequence{Seq: 1, Boot: "b", Offered: true},
+	}))
+	l.processOffer(encode(&proxy.StasisOffer{
+		StasisStart: stasisStart("ch1", "", ""),
+		Claim:       proxy.Claim{Token: "t1", Attempt: 1},
+	}))
+
+	// A channel which is not offered is handled from its event
+	l.processEvent(encode(&proxy.SequencedEvent{
+		Event:         stasisStart("ch2", "", ""),
+		EventSequence: proxy.EventSequence{Seq: 2, Boot: "b"},
+	}))
+
+	got := make(map[string]bool)
+	for len(got) < 2 {
+		select {
+		case id := <-handled:
+			got[id] = true
+		case <-time.After(time.Second):
+			t.Fatalf("channels were not handled: %v", got)
+		}
+	}
+	if !got["ch1"] || !got["ch2"] {
+		t.Errorf("unexpected channels handled: %v", got)
+	}
+	select {
+	case got := <-handled:
+		t.Errorf("unexpected handling of %s", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if len(claimed) != 1 || claimed[0] != "ch1/t1" {
+		t.Errorf("unexpected claims: %v", claimed)
+	}
+}
+
+func TestListenSubject(t *testing.T) {
+	c := &Client{
+		core:    &core{prefix: "ari.", mbus: &messagebus.NatsBus{}},
+		appName: "test",
+	}
+	if subj := c.listenSubject(); subj != "ari.event.test.>" {
+		t.Errorf("unexpected legacy subject %q", subj)
+	}
+
+	c.typedEvents = true
+	if subj := c.listenSubject(); subj != "ari.typedevent.test.*.StasisStart" {
+		t.Errorf("unexpected typed subject %q", subj)
+	}
+}
+
+func TestListenerInline(t *testing.T) {
+	var handled bool
+	h := func(h *ari.ChannelHandle, e *ari.StasisStart) {
+		handled = true
+		if e.Channel.ID == "panic" {
+			panic("handler failure")
+		}
+	}
+
+	l := newListener(context.Background(), &ListenOptions{}, nil, h, (&listenTestBus{}).subscribe)
+	l.inline = true
+
+	send := func(id string) {
+		data, err := json.Marshal(stasisStart(id, "", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.processEvent(data)
+	}
+
+	send("ch1")
+	if !handled {
+		t.Error("expected the handler to be run within the callback")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected the handler's panic not to be recovered")
+		}
+	}()
+	send("panic")
+}
@@ -0,0 +1,509 @@
+// Package mirror provides a local, event-driven copy of the state of the
+// channels and bridges of an ARI application, so that it may be queried
+// without a round trip to Asterisk.
+package mirror
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/bus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+	"github.com/rotisserie/eris"
+)
+
+// Logger is the logger of the package.  It discards its output by default.
+var Logger = log15.New()
+
+func init() {
+	Logger.SetHandler(log15.DiscardHandler())
+}
+
+// ResyncDelay is the minimum amount of time between two resynchronizations
+// triggered by sequence gaps
+var ResyncDelay = time.Second
+
+// events are the events which the Mirror follows
+var events = []string{
+	ari.Events.StasisStart,
+	ari.Events.StasisEnd,
+	ari.Events.ChannelCreated,
+	ari.Events.ChannelDestroyed,
+	ari.Events.ChannelStateChange,
+	ari.Events.ChannelConnectedLine,
+	ari.Events.ChannelDialplan,
+	ari.Events.ChannelEnteredBridge,
+	ari.Events.ChannelLeftBridge,
+	ari.Events.BridgeCreated,
+	ari.Events.BridgeDestroyed,
+	ari.Events.BridgeMerged,
+	bus.SequenceGapEvent,
+}
+
+// Channel is the mirrored state of a channel
+type Channel struct {
+	// Key is the key of the channel, which identifies its node
+	Key *ari.Key
+
+	// Data is the last known data of the channel
+	Data *ari.ChannelData
+}
+
+// Bridge is the mirrored state of a bridge
+type Bridge struct {
+	// Key is the key of the bridge, which identifies its node
+	Key *ari.Key
+
+	// Data is the last known data of the bridge, which lists its members
+	Data *ari.BridgeData
+}
+
+// Mirror is a local copy of the state of the channels and bridges of an ARI
+// application.  It is seeded from the channel and bridge lists and kept
+// current from the event stream, and it is synchronized again whenever a gap
+// is detected in the event stream.
+//
+// Only the channels which the application follows, such as those in Stasis,
+// are mirrored, since the events of the others are not received.  A channel
+// is kept from its entry into Stasis until its destruction.
+//
+// The Channels and Bridges returned by a Mirror are shared and must not be
+// modified.
+type Mirror struct {
+	ac ari.Client
+
+	channels map[string]*Channel
+	bridges  map[string]*Bridge
+
+	// pending are the events received during a synchronization, which are
+	// applied to its result
+	pending []ari.Event
+	syncing bool
+
+	resync chan struct{}
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	syncMu sync.Mutex
+}
+
+// New creates a Mirror of the application of the given client, which is
+// kept current until the context is closed or the Mirror is closed.  It
+// returns once the Mirror has first been synchronized.
+func New(ctx context.Context, ac ari.Client) (*Mirror, error) {
+	m := newMirror(ac)
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	go m.run(ctx, subscribe(ac))
+
+	// Events received before the synchronization starts are reflected by it
+	if err := m.Sync(); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Close stops following the events of the application
+func (m *Mirror) Close() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+func newMirror(ac ari.Client) *Mirror {
+	return &Mirror{
+		ac:       ac,
+		channels: make(map[string]*Channel),
+		bridges:  make(map[string]*Bridge),
+		resync:   make(chan struct{}, 1),
+	}
+}
+
+// sequencedSubscriber is implemented by buses which deliver events along with
+// their position in the event streams of the ARI proxies
+type sequencedSubscriber interface {
+	SubscribeWithOptions(key *ari.Key, o bus.SubscriptionOptions, n ...string) *bus.Subscription
+}
+
+// subscribe subscribes to the events which the Mirror follows, along with
+// their sequence if the client's bus provides it
+func subscribe(ac ari.Client) ari.Subscription {
+	if b, ok := ac.Bus().(sequencedSubscriber); ok {
+		return b.SubscribeWithOptions(nil, bus.SubscriptionOptions{Sequenced: true}, events...)
+	}
+	return ac.Bus().Subscribe(nil, events...)
+}
+
+func (m *Mirror) run(ctx context.Context, sub ari.Subscription) {
+	defer sub.Cancel()
+
+	go m.resyncLoop(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if e.GetType() == bus.SequenceGapEvent {
+				select {
+				case m.resync <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			m.Apply(e)
+		}
+	}
+}
+
+// resyncLoop synchronizes the Mirror as requested, no more than once per
+// ResyncDelay
+func (m *Mirror) resyncLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.resync:
+		}
+
+		Logger.Info("event sequence gap detected; resynchronizing state")
+		if err := m.Sync(); err != nil {
+			Logger.Error("failed to resynchronize state", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ResyncDelay):
+		}
+	}
+}
+
+// Sync replaces the state of the Mirror with the current channels and
+// bridges of the application.  The events received during the
+// synchronization are applied to its result, except for those which a
+// snapshot (see loadSnapshot) is known to reflect already, by their sequence.
+func (m *Mirror) Sync() error {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	m.mu.Lock()
+	m.syncing = true
+	m.pending = nil
+	m.mu.Unlock()
+
+	channels, bridges, seqs, err := m.load()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.syncing = false
+	pending := m.pending
+	m.pending = nil
+	if err != nil {
+		return err
+	}
+
+	m.channels = channels
+	m.bridges = bridges
+	for _, e := range pending {
+		if reflected(e, seqs) {
+			continue
+		}
+		m.apply(e)
+	}
+	return nil
+}
+
+// reflected indicates whether the event precedes the given positions in the
+// event streams of the nodes, at which a snapshot was taken
+func reflected(e ari.Event, seqs map[string]proxy.EventSequence) bool {
+	se, ok := e.(*proxy.SequencedEvent)
+	if !ok || se.Seq == 0 {
+		return false
+	}
+	at, ok := seqs[se.GetNode()]
+	return ok && at.Boot == se.Boot && se.Seq <= at.Seq
+}
+
+// snapshotter is implemented by clients which retrieve the data of all the
+// entities of an application in a single request
+type snapshotter interface {
+	ClusterSnapshot() (*proxy.NodeSnapshot, error)
+	Supports(capability string) bool
+}
+
+// load retrieves the current channels and bridges, from a snapshot if every
+// ARI proxy supports them.  Snapshots also give the positions in the event
+// streams of the nodes at which they were taken.
+func (m *Mirror) load() (map[string]*Channel, map[string]*Bridge, map[string]proxy.EventSequence, error) {
+	followed, err := m.followedChannels()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if sc, ok := m.ac.(snapshotter); ok && sc.Supports(proxy.CapabilitySnapshot) {
+		return m.loadSnapshot(sc, followed)
+	}
+
+	channels := make(map[string]*Channel)
+	bridges := make(map[string]*Bridge)
+
+	keys, err := m.ac.Channel().List(nil)
+	if err != nil {
+		return nil, nil, nil, eris.Wrap(err, "failed to list channels")
+	}
+	for _, k := range keys {
+		if !followed[k.ID] {
+			continue
+		}
+		data, err := m.ac.Channel().Data(k)
+		if err != nil {
+			// The channel may have been destroyed since it was listed
+			Logger.Debug("failed to get channel data", "channel", k.ID, "error", err)
+			continue
+		}
+		channels[k.ID] = &Channel{Key: k, Data: data}
+	}
+
+	keys, err = m.ac.Bridge().List(nil)
+	if err != nil {
+		return nil, nil, nil, eris.Wrap(err, "failed to list bridges")
+	}
+	for _, k := range keys {
+		data, err := m.ac.Bridge().Data(k)
+		if err != nil {
+			Logger.Debug("failed to get bridge data", "bridge", k.ID, "error", err)
+			continue
+		}
+		bridges[k.ID] = &Bridge{Key: k, Data: data}
+	}
+
+	return channels, bridges, nil, nil
+}
+
+// followedChannels returns the IDs of the channels which the application
+// follows, on any node: those in Stasis and those to which it subscribed.
+// Asterisk lists the other channels as well, but their events are not
+// received.
+func (m *Mirror) followedChannels() (map[string]bool, error) {
+	keys, err := m.ac.Application().List(nil)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to list applications")
+	}
+
+	ret := make(map[string]bool)
+	for _, k := range keys {
+		if k.ID != m.ac.ApplicationName() {
+			continue
+		}
+		data, err := m.ac.Application().Data(k)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to get application data")
+		}
+		for _, id := range data.ChannelIDs {
+			ret[id] = true
+		}
+	}
+	return ret, nil
+}
+
+// loadSnapshot retrieves the current channels, out of those which are
+// followed, and bridges from a snapshot
+func (m *Mirror) loadSnapshot(sc snapshotter, followed map[string]bool) (map[string]*Channel, map[string]*Bridge, map[string]proxy.EventSequence, error) {
+	snap, err := sc.ClusterSnapshot()
+	if err != nil {
+		return nil, nil, nil, eris.Wrap(err, "failed to get snapshot")
+	}
+
+	channels := make(map[string]*Channel)
+	for _, d := range snap.Channels {
+		if !followed[d.ID] {
+			continue
+		}
+		channels[d.ID] = &Channel{Key: dataKey(d.Key, ari.ChannelKey, d.ID), Data: d}
+	}
+
+	bridges := make(map[string]*Bridge)
+	for _, d := range snap.Bridges {
+		bridges[d.ID] = &Bridge{Key: dataKey(d.Key, ari.BridgeKey, d.ID), Data: d}
+	}
+
+	return channels, bridges, snap.Sequences, nil
+}
+
+// dataKey returns the key of an entity, as given by its data if present
+func dataKey(k *ari.Key, kind, id string) *ari.Key {
+	if k != nil {
+		return k
+	}
+	return ari.NewKey(kind, id)
+}
+
+// Apply updates the Mirror from the given event, which may be a
+// proxy.SequencedEvent
+func (m *Mirror) Apply(e ari.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apply(e)
+	if m.syncing {
+		m.pending = append(m.pending, e)
+	}
+}
+
+func (m *Mirror) apply(e ari.Event) {
+	if se, ok := e.(*proxy.SequencedEvent); ok {
+		e = se.Event
+	}
+
+	switch v := e.(type) {
+	case *ari.StasisStart:
+		m.setChannel(e, v.Channel)
+	case *ari.ChannelCreated:
+		m.setChannel(e, v.Channel)
+	case *ari.ChannelStateChange:
+		m.setChannel(e, v.Channel)
+	case *ari.ChannelConnectedLine:
+		m.setChannel(e, v.Channel)
+	case *ari.ChannelDialplan:
+		m.setChannel(e, v.Channel)
+	case *ari.StasisEnd:
+		// The channel outlives its Stasis, for instance if it continues in
+		// the dialplan
+		m.setChannel(e, v.Channel)
+	case *ari.ChannelDestroyed:
+		delete(m.channels, v.Channel.ID)
+	case *ari.ChannelEnteredBridge:
+		m.setChannel(e, v.Channel)
+		m.setBridge(e, v.Bridge)
+	case *ari.ChannelLeftBridge:
+		m.setChannel(e, v.Channel)
+		m.setBridge(e, v.Bridge)
+	case *ari.BridgeCreated:
+		m.setBridge(e, v.Bridge)
+	case *ari.BridgeMerged:
+		m.setBridge(e, v.Bridge)
+		m.setBridge(e, v.BridgeFrom)
+	case *ari.BridgeDestroyed:
+		delete(m.bridges, v.Bridge.ID)
+	}
+}
+
+func (m *Mirror) setChannel(e ari.Event, data ari.ChannelData) {
+	if data.ID == "" {
+		return
+	}
+	m.channels[data.ID] = &Channel{
+		Key:  e.Key(ari.ChannelKey, data.ID),
+		Data: &data,
+	}
+}
+
+func (m *Mirror) setBridge(e ari.Event, data ari.BridgeData) {
+	if data.ID == "" {
+		return
+	}
+	m.bridges[data.ID] = &Bridge{
+		Key:  e.Key(ari.BridgeKey, data.ID),
+		Data: &data,
+	}
+}
+
+// Channel returns the channel with the given ID, if it is known
+func (m *Mirror) Channel(id string) (*Channel, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.channels[id]
+	return c, ok
+}
+
+// Channels returns the channels which satisfy the given test, or all
+// channels if it is nil, ordered by ID
+func (m *Mirror) Channels(f func(*Channel) bool) []*Channel {
+	m.mu.RLock()
+	ret := make([]*Channel, 0, len(m.channels))
+	for _, c := range m.channels {
+		if f == nil || f(c) {
+			ret = append(ret, c)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Data.ID < ret[j].Data.ID
+	})
+	return ret
+}
+
+// ChannelsByState returns the channels in the given state (such as "Up" or
+// "Ringing")
+func (m *Mirror) ChannelsByState(state string) []*Channel {
+	return m.Channels(func(c *Channel) bool {
+		return c.Data.State == state
+	})
+}
+
+// ChannelsByNode returns the channels of the given Asterisk node
+func (m *Mirror) ChannelsByNode(node string) []*Channel {
+	return m.Channels(func(c *Channel) bool {
+		return c.Key.Node == node
+	})
+}
+
+// Bridge returns the bridge with the given ID, if it is known
+func (m *Mirror) Bridge(id string) (*Bridge, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	b, ok := m.bridges[id]
+	return b, ok
+}
+
+// Bridges returns all known bridges, ordered by ID
+func (m *Mirror) Bridges() []*Bridge {
+	m.mu.RLock()
+	ret := make([]*Bridge, 0, len(m.bridges))
+	for _, b := range m.bridges {
+		ret = append(ret, b)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Data.ID < ret[j].Data.ID
+	})
+	return ret
+}
+
+// BridgeMembers returns the IDs of the channels in the given bridge
+func (m *Mirror) BridgeMembers(id string) []string {
+	b, ok := m.Bridge(id)
+	if !ok {
+		return nil
+	}
+	return append([]string(nil), b.Data.ChannelIDs...)
+}
+
+// ChannelBridges returns the IDs of the bridges which the given channel is in
+func (m *Mirror) ChannelBridges(id string) []string {
+	var ret []string
+	for _, b := range m.Bridges() {
+		for _, c := range b.Data.ChannelIDs {
+			if c == id {
+				ret = append(ret, b.Data.ID)
+				break
+			}
+		}
+	}
+	return ret
+}
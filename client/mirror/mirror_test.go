@@ -0,0 +1,227 @@
+package mirror
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/bus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/stretchr/testify/mock"
+)
+
+type testSubscription struct {
+	events chan ari.Event
+}
+
+func (s *testSubscription) Events() <-chan ari.Event {
+	return s.events
+}
+
+func (s *testSubscription) Cancel() {}
+
+func channelKey(id, node string) *ari.Key {
+	return ari.NewKey(ari.ChannelKey, id, ari.WithApp("test"), ari.WithNode(node))
+}
+
+func eventData(t string) ari.EventData {
+	return ari.EventData{
+		Type:        t,
+		Application: "test",
+		Node:        "n1",
+	}
+}
+
+func waitFor(t *testing.T, desc string, f func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", desc)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c1 := channelKey("c1", "n1")
+	c2 := channelKey("c2", "n2")
+	b1 := ari.NewKey(ari.BridgeKey, "b1", ari.WithApp("test"), ari.WithNode("n1"))
+
+	c9 := channelKey("c9", "n1")
+	a1 := ari.NewKey(ari.ApplicationKey, "test", ari.WithNode("n1"))
+
+	app := &arimocks.Application{}
+	app.On("List", (*ari.Key)(nil)).Return([]*ari.Key{a1, ari.NewKey(ari.ApplicationKey, "other")}, nil)
+	app.On("Data", a1).Return(&ari.ApplicationData{Name: "test", ChannelIDs: []string{"c1", "c2"}}, nil)
+
+	// The channel c9 is not in Stasis
+	ch := &arimocks.Channel{}
+	ch.On("List", (*ari.Key)(nil)).Return([]*ari.Key{c1, c9}, nil).Once()
+	ch.On("List", (*ari.Key)(nil)).Return([]*ari.Key{c1, c2, c9}, nil)
+	ch.On("Data", c1).Return(&ari.ChannelData{ID: "c1", State: "Up"}, nil)
+	ch.On("Data", c2).Return(&ari.ChannelData{ID: "c2", State: "Ringing"}, nil)
+
+	br := &arimocks.Bridge{}
+	br.On("List", (*ari.Key)(nil)).Return([]*ari.Key{b1}, nil)
+	br.On("Data", b1).Return(&ari.BridgeData{ID: "b1", ChannelIDs: []string{"c1"}}, nil)
+
+	sub := &testSubscription{events: make(chan ari.Event, 10)}
+	args := []interface{}{(*ari.Key)(nil)}
+	for _, e := range events {
+		args = append(args, e)
+	}
+	b := &arimocks.Bus{}
+	b.On("Subscribe", args...).Return(sub)
+
+	cl := &arimocks.Client{}
+	cl.On("ApplicationName").Return("test")
+	cl.On("Application").Return(app)
+	cl.On("Channel").Return(ch)
+	cl.On("Bridge").Return(br)
+	cl.On("Bus").Return(b)
+
+	m, err := New(ctx, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if c, ok := m.Channel("c1"); !ok || c.Data.State != "Up" {
+		t.Fatalf("expected seeded channel, got %+v", c)
+	}
+	if _, ok := m.Channel("c9"); ok {
+		t.Error("expected channel outside of Stasis not to be seeded")
+	}
+	if members := m.BridgeMembers("b1"); len(members) != 1 || members[0] != "c1" {
+		t.Errorf("unexpected bridge members: %v", members)
+	}
+
+	// Keep the state current from events
+	sub.events <- &ari.StasisStart{
+		EventData: eventData("StasisStart"),
+		Channel:   ari.ChannelData{ID: "c3", State: "Ring"},
+	}
+	sub.events <- &ari.ChannelStateChange{
+		EventData: eventData("ChannelStateChange"),
+		Channel:   ari.ChannelData{ID: "c3", State: "Up"},
+	}
+	sub.events <- &ari.ChannelEnteredBridge{
+		EventData: eventData("ChannelEnteredBridge"),
+		Channel:   ari.ChannelData{ID: "c3", State: "Up"},
+		Bridge:    ari.BridgeData{ID: "b1", ChannelIDs: []string{"c1", "c3"}},
+	}
+	sub.events <- &ari.StasisEnd{
+		EventData: eventData("StasisEnd"),
+		Channel:   ari.ChannelData{ID: "c3", State: "Up"},
+	}
+	sub.events <- &ari.ChannelDestroyed{
+		EventData: eventData("ChannelDestroyed"),
+		Channel:   ari.ChannelData{ID: "c1"},
+	}
+
+	waitFor(t, "channel c1 to be destroyed", func() bool {
+		_, ok := m.Channel("c1")
+		return !ok
+	})
+	if up := m.ChannelsByState("Up"); len(up) != 1 || up[0].Data.ID != "c3" {
+		t.Errorf("expected channel to be kept after leaving Stasis, got channels in state Up: %v", up)
+	}
+	if on := m.ChannelsByNode("n1"); len(on) != 1 || on[0].Data.ID != "c3" {
+		t.Errorf("unexpected channels on node n1: %v", on)
+	}
+	if bridges := m.ChannelBridges("c3"); len(bridges) != 1 || bridges[0] != "b1" {
+		t.Errorf("unexpected bridges of c3: %v", bridges)
+	}
+
+	// Resynchronize on a sequence gap
+	sub.events <- &bus.SequenceGap{
+		EventData: eventData(bus.SequenceGapEvent),
+		Kind:      bus.GapMissed,
+	}
+
+	waitFor(t, "resynchronization", func() bool {
+		_, ok := m.Channel("c2")
+		return ok
+	})
+	if _, ok := m.Channel("c3"); ok {
+		t.Error("expected resynchronization to drop channels no longer listed")
+	}
+	if on := m.ChannelsByNode("n2"); len(on) != 1 {
+		t.Errorf("unexpected channels on node n2: %v", on)
+	}
+}
+
+type snapshotClient struct {
+	*arimocks.Client
+	snap *proxy.NodeSnapshot
+}
+
+func (c *snapshotClient) ClusterSnapshot() (*proxy.NodeSnapshot, error) {
+	return c.snap, nil
+}
+
+func (c *snapshotClient) Supports(capability string) bool {
+	return capability == proxy.CapabilitySnapshot
+}
+
+func TestMirrorSyncStaleEvents(t *testing.T) {
+	a1 := ari.NewKey(ari.ApplicationKey, "test", ari.WithNode("n1"))
+	app := &arimocks.Application{}
+	app.On("List", (*ari.Key)(nil)).Return([]*ari.Key{a1}, nil)
+
+	cl := &arimocks.Client{}
+	cl.On("ApplicationName").Return("test")
+	cl.On("Application").Return(app)
+
+	sc := &snapshotClient{Client: cl}
+	m := newMirror(sc)
+
+	stateChange := func(id, state string, seq uint64, boot string) ari.Event {
+		return &proxy.SequencedEvent{
+			Event: &ari.ChannelStateChange{
+				EventData: eventData("ChannelStateChange"),
+				Channel:   ari.ChannelData{ID: id, State: state},
+			},
+			EventSequence: proxy.EventSequence{Seq: seq, Boot: boot},
+		}
+	}
+
+	// Events are received while the snapshot is taken: c1's precedes it, c2's
+	// follows it and c3's comes from a later run of the proxy
+	app.On("Data", a1).Return(&ari.ApplicationData{Name: "test", ChannelIDs: []string{"c1", "c2", "c3"}}, nil).Run(func(mock.Arguments) {
+		m.Apply(stateChange("c1", "Ringing", 4, "b1"))
+		m.Apply(stateChange("c2", "Busy", 6, "b1"))
+		m.Apply(stateChange("c3", "Busy", 1, "b2"))
+	})
+	sc.snap = &proxy.NodeSnapshot{
+		Sequences: map[string]proxy.EventSequence{
+			"n1": {Seq: 5, Boot: "b1"},
+		},
+		Channels: []*ari.ChannelData{
+			{Key: channelKey("c1", "n1"), ID: "c1", State: "Up"},
+			{Key: channelKey("c2", "n1"), ID: "c2", State: "Up"},
+			{Key: channelKey("c3", "n1"), ID: "c3", State: "Up"},
+		},
+	}
+
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, _ := m.Channel("c1"); c == nil || c.Data.State != "Up" {
+		t.Errorf("expected event reflected by the snapshot to be dropped, got %+v", c)
+	}
+	if c, _ := m.Channel("c2"); c == nil || c.Data.State != "Busy" {
+		t.Errorf("expected later event to be applied, got %+v", c)
+	}
+	if c, _ := m.Channel("c3"); c == nil || c.Data.State != "Busy" {
+		t.Errorf("expected event of a later boot to be applied, got %+v", c)
+	}
+}
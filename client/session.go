@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/bus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/session"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+)
+
+// NewDialog creates a new Client which is scoped to a new dialog.  See
+// (*Client).NewDialog.
+func NewDialog(ctx context.Context, opts ...OptionFunc) (*Client, error) {
+	c, err := New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.scopeToDialog(rid.New("dg"))
+
+	return c, nil
+}
+
+// NewDialog returns a new Client, derived from this one, which is scoped to a
+// new dialog.  Every request made through the returned Client carries the
+// dialog ID, so that the entities on which it operates are bound to the
+// dialog, and its Bus delivers only the events of the dialog.  Closing the
+// returned Client releases the dialog's bindings on the ARI proxies.
+func (c *Client) NewDialog(ctx context.Context) *Client {
+	d := c.New(ctx)
+	d.scopeToDialog(rid.New("dg"))
+
+	return d
+}
+
+// Dialog returns the dialog to which the Client is scoped, or nil if it is not scoped to a dialog
+func (c *Client) Dialog() *session.Dialog {
+	return c.dialog
+}
+
+func (c *Client) scopeToDialog(id string) {
+	c.dialog = session.NewDialog(id, &dialogTransport{c})
+
+	c.bus = &dialogBus{
+		Bus:    c.core.newBus(),
+		dialog: c.dialog,
+	}
+}
+
+// dialogTransport implements session.Transport for a Client
+type dialogTransport struct {
+	c *Client
+}
+
+func (t *dialogTransport) Command(class string, req *proxy.Request) (*proxy.Response, error) {
+	return t.c.request(class, req)
+}
+
+func (t *dialogTransport) Subscribe(dialog string, n ...string) ari.Subscription {
+	return t.c.bus.(*dialogBus).Bus.Subscribe(ari.NewKey("", "", ari.WithDialog(dialog)), n...)
+}
+
+// dialogBus is an ari.Bus whose subscriptions are limited to the events of a dialog
+type dialogBus struct {
+	*bus.Bus
+
+	dialog *session.Dialog
+}
+
+// Subscribe implements ari.Bus
+func (b *dialogBus) Subscribe(key *ari.Key, n ...string) ari.Subscription {
+	return b.Bus.Subscribe(b.dialog.Key(key), n...)
+}
+
+// SubscribeWithOptions limits (*bus.Bus).SubscribeWithOptions to the events of the dialog
+func (b *dialogBus) SubscribeWithOptions(key *ari.Key, o bus.SubscriptionOptions, n ...string) *bus.Subscription {
+	return b.Bus.SubscribeWithOptions(b.dialog.Key(key), o, n...)
+}
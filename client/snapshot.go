@@ -0,0 +1,72 @@
+package client
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// NodeSnapshot returns the data of all the channels, bridges, playbacks, live
+// recordings and device states of the given node in a single request
+func (c *Client) NodeSnapshot(node string) (*proxy.NodeSnapshot, error) {
+	resp, err := c.makeRequest("data", &proxy.Request{
+		Kind: "NodeSnapshot",
+		Key:  ari.NewKey("", "", ari.WithApp(c.appName), ari.WithNode(node)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err() != nil {
+		return nil, resp.Err()
+	}
+	if resp.Snapshot == nil {
+		return nil, ErrNil
+	}
+	return resp.Snapshot, nil
+}
+
+// ClusterSnapshot returns the merged snapshots (see NodeSnapshot) of every
+// node of the application.  If any node fails to respond, the snapshots
+// which were received are returned along with the error, which names the
+// known nodes from which no snapshot was received.
+func (c *Client) ClusterSnapshot() (*proxy.NodeSnapshot, error) {
+	ret := &proxy.NodeSnapshot{}
+
+	responses, err := c.makeRequests("data", &proxy.Request{
+		Kind: "NodeSnapshot",
+		Key:  ari.NewKey("", "", ari.WithApp(c.appName)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	received := make(map[string]bool)
+	for _, r := range responses {
+		if r.Err() != nil {
+			err = r.Err()
+			continue
+		}
+		if r.Snapshot != nil {
+			received[r.Snapshot.Node] = true
+		}
+		ret.Merge(r.Snapshot)
+	}
+
+	var missing []string
+	for _, m := range c.core.cluster.App(c.appName, c.core.clusterMaxAge) {
+		if !received[m.ID] {
+			missing = append(missing, m.ID)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		if err != nil {
+			return ret, eris.Wrapf(err, "no snapshot received from nodes %s", strings.Join(missing, ", "))
+		}
+		return ret, eris.Errorf("no snapshot received from nodes %s", strings.Join(missing, ", "))
+	}
+	return ret, err
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/cluster"
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// snapshotBus answers NodeSnapshot requests for the given nodes only, as if
+// the others had timed out
+type snapshotBus struct {
+	messagebus.Client
+	nodes []string
+}
+
+func (b *snapshotBus) MultipleRequest(topic string, req *proxy.Request, expectedResp int) (ret []*proxy.Response, err error) {
+	for _, n := range b.nodes {
+		ret = append(ret, &proxy.Response{
+			Snapshot: &proxy.NodeSnapshot{
+				Node:     n,
+				Channels: []*ari.ChannelData{{ID: "c" + n}},
+			},
+		})
+	}
+	return ret, nil
+}
+
+func TestClusterSnapshotMissingNodes(t *testing.T) {
+	b := &snapshotBus{nodes: []string{"n1"}}
+	c := &Client{
+		core: &core{
+			prefix:        "ari.",
+			mbus:          b,
+			cluster:       cluster.New(),
+			clusterMaxAge: DefaultClusterMaxAge,
+		},
+		appName: "test",
+	}
+	for _, n := range []string{"n1", "n2", "n3"} {
+		c.core.cluster.Announce(n, "test", cluster.Features{
+			Version:      proxy.ProtocolVersion,
+			Capabilities: []string{proxy.CapabilitySnapshot},
+		})
+	}
+
+	snap, err := c.ClusterSnapshot()
+	if err == nil || !strings.Contains(err.Error(), "n2, n3") {
+		t.Errorf("expected error naming the missing nodes, got %v", err)
+	}
+	if snap == nil || len(snap.Channels) != 1 {
+		t.Errorf("expected the received snapshot to be returned, got %+v", snap)
+	}
+
+	b.nodes = []string{"n1", "n2", "n3"}
+	snap, err = c.ClusterSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Channels) != 3 {
+		t.Errorf("unexpected channels: %v", snap.Channels)
+	}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+type textMessage struct {
+	c *Client
+}
+
+// Send sends a text message to an endpoint.  Messages are sent as "create"
+// requests, so that exactly one ARI proxy sends each of them.  When the client
+// is scoped to a dialog, the endpoint is bound to the dialog, so that replies
+// to the message are delivered to it.
+func (t *textMessage) Send(from, tech, resource, body string, vars map[string]string) error {
+	return t.send(&proxy.Request{
+		Kind: "TextMessageSend",
+		Key:  ari.NewKey("", "", ari.WithApp(t.c.appName)),
+		TextMessageSend: &proxy.TextMessageSend{
+			From:      from,
+			Tech:      tech,
+			Resource:  resource,
+			Body:      body,
+			Variables: vars,
+		},
+	})
+}
+
+// SendByURI sends a text message to an endpoint by free-form URI
+func (t *textMessage) SendByURI(from, to, body string, vars map[string]string) error {
+	return t.send(&proxy.Request{
+		Kind: "TextMessageSendByURI",
+		Key:  ari.NewKey("", "", ari.WithApp(t.c.appName)),
+		TextMessageSendByURI: &proxy.TextMessageSendByURI{
+			From:      from,
+			To:        to,
+			Body:      body,
+			Variables: vars,
+		},
+	})
+}
+
+func (t *textMessage) send(req *proxy.Request) error {
+	resp, err := t.c.makeRequest("create", req)
+	if err != nil {
+		return err
+	}
+	return resp.Err()
+}
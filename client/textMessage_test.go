@@ -0,0 +1,15 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/internal/integration"
+)
+
+func TestTextMessageSend(t *testing.T) {
+	integration.TestTextMessageSend(t, &srv{})
+}
+
+func TestTextMessageSendByURI(t *testing.T) {
+	integration.TestTextMessageSendByURI(t, &srv{})
+}
@@ -5,8 +5,17 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
 	"github.com/CyCoreSystems/ari-proxy/v5/server"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/audit"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dedupe"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/eventbuf"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/eventfilter"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/fallback"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/ratelimit"
 	"github.com/CyCoreSystems/ari/v5/client/native"
 
 	"github.com/inconshreveable/log15"
@@ -64,13 +73,36 @@ func init() {
 
 	p.String("nats.url", nats.DefaultURL, "URL for connecting to the NATS cluster") //backward compatibility
 	p.String("messagebus.url", nats.DefaultURL, "URL for connecting to the Message Bus cluster")
+	p.String("messagebus.codec", "json", "Codec in which events are published: json or msgpack (requests are accepted in any codec)")
 	p.String("ari.application", "", "ARI Stasis Application")
 	p.String("ari.username", "", "Username for connecting to ARI")
 	p.String("ari.password", "", "Password for connecting to ARI")
 	p.String("ari.http_url", "http://localhost:8088/ari", "HTTP Base URL for connecting to ARI")
 	p.String("ari.websocket_url", "ws://localhost:8088/ari/events", "Websocket URL for connecting to ARI")
 
-	for _, n := range []string{"verbose", "nats.url", "messagebus.url", "ari.application", "ari.username", "ari.password", "ari.http_url", "ari.websocket_url"} {
+	p.String("audit.file", "", "File to which the audit log of mutating requests should be written (disabled if empty)")
+	p.Int64("audit.max_size", 100*1024*1024, "Size in bytes at which the audit log should be rotated (0 to disable)")
+	p.Duration("audit.max_age", 24*time.Hour, "Age at which the audit log should be rotated (0 to disable)")
+	p.StringSlice("audit.redact", nil, "Request payload fields (dotted JSON paths) to redact from the audit log")
+	p.Bool("audit.publish", false, "Publish audit entries to the MessageBus audit subject")
+
+	p.Duration("dedupe.ttl", dedupe.DefaultTTL, "Amount of time for which responses are retained to answer retried requests")
+	p.Int("dedupe.size", dedupe.DefaultSize, "Maximum number of responses retained to answer retried requests (0 to disable)")
+
+	p.String("dialog.store", "memory", "Store for dialog bindings: memory, file or nats")
+	p.String("dialog.path", "/var/lib/ari-proxy/dialogs", "Directory in which dialog bindings are stored, when the file store is selected")
+	p.Duration("dialog.sweep_interval", server.DefaultDialogSweepInterval, "Interval at which dialog bindings are checked against existing channels and bridges (0 to disable)")
+	p.Duration("dialog.max_age", server.DefaultDialogMaxAge, "Age after which dialog bindings are removed regardless (0 to disable)")
+	p.String("dialog.bucket", dialog.DefaultBucket, "NATS KV bucket in which dialog bindings are stored, when the nats store is selected")
+
+	p.String("events.subjects", server.EventSubjectsLegacy, "Subjects to which events are published: legacy, typed or compat (both)")
+	p.Int("events.buffer_size", eventbuf.DefaultSize, "Number of recent events retained for replay to clients (0 to disable)")
+
+	p.Duration("claim.timeout", 0, "Time within which a listener must claim a channel entering Stasis before it is offered again (0 to disable offers)")
+	p.Int("claim.attempts", server.DefaultClaimAttempts, "Number of times a channel is offered before the claim fallback is applied")
+	p.Duration("claim.listener_ttl", 0, "Time after its last announcement for which a listener is considered present; channels entering Stasis with no listener present receive the claim fallback (0 to disable)")
+
+	for _, n := range []string{"verbose", "nats.url", "messagebus.url", "messagebus.codec", "ari.application", "ari.username", "ari.password", "ari.http_url", "ari.websocket_url", "audit.file", "audit.max_size", "audit.max_age", "audit.redact", "audit.publish", "dedupe.ttl", "dedupe.size", "dialog.store", "dialog.path", "dialog.bucket", "dialog.sweep_interval", "dialog.max_age", "events.subjects", "events.buffer_size", "claim.timeout", "claim.attempts", "claim.listener_ttl"} {
 		err := viper.BindPFlag(n, p.Lookup(n))
 		if err != nil {
 			panic("failed to bind flag " + n)
@@ -110,6 +142,116 @@ func runServer(ctx context.Context, log log15.Logger) error {
 	srv := server.New()
 	srv.Log = log
 
+	if auditFile := viper.GetString("audit.file"); auditFile != "" {
+		auditLog, err := audit.New(audit.Config{
+			Path:    auditFile,
+			MaxSize: viper.GetInt64("audit.max_size"),
+			MaxAge:  viper.GetDuration("audit.max_age"),
+			Redact:  viper.GetStringSlice("audit.redact"),
+		})
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close() // nolint: errcheck
+
+		srv.Audit = auditLog
+		srv.AuditPublish = viper.GetBool("audit.publish")
+	}
+
+	srv.DialogSweepInterval = viper.GetDuration("dialog.sweep_interval")
+	srv.DialogMaxAge = viper.GetDuration("dialog.max_age")
+
+	if viper.IsSet("dialog.propagation") {
+		if err := viper.UnmarshalKey("dialog.propagation", &srv.DialogPropagation); err != nil {
+			return err
+		}
+	}
+
+	switch store := viper.GetString("dialog.store"); store {
+	case "", "memory":
+	case "file":
+		dialogs, err := dialog.NewFileManager(viper.GetString("dialog.path"))
+		if err != nil {
+			return err
+		}
+		defer dialogs.Close() // nolint: errcheck
+
+		srv.Dialog = dialogs
+	case "nats":
+		nc, err := nats.Connect(messagebusURL)
+		if err != nil {
+			return err
+		}
+		defer nc.Close()
+
+		kv, err := dialog.NewNatsKV(nc, viper.GetString("dialog.bucket"))
+		if err != nil {
+			return err
+		}
+		if srv.Dialog, err = dialog.NewKVManager(ctx, kv, log); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown dialog store %q", store)
+	}
+
+	if size := viper.GetInt("dedupe.size"); size > 0 {
+		srv.Dedupe = dedupe.New(viper.GetDuration("dedupe.ttl"), size)
+	} else {
+		srv.Dedupe = nil
+	}
+
+	switch mode := viper.GetString("events.subjects"); mode {
+	case "", server.EventSubjectsLegacy, server.EventSubjectsTyped, server.EventSubjectsCompat:
+		srv.EventSubjects = mode
+		if mode == server.EventSubjectsTyped {
+			log.Warn("events are published to the typed subjects only; clients which do not use typed events, including their listeners, receive none")
+		}
+	default:
+		return fmt.Errorf("unknown event subject mode %q", mode)
+	}
+
+	srv.Codec = messagebus.CodecByName(viper.GetString("messagebus.codec"))
+	if srv.Codec == nil {
+		return fmt.Errorf("unknown messagebus codec %q", viper.GetString("messagebus.codec"))
+	}
+
+	srv.ClaimTimeout = viper.GetDuration("claim.timeout")
+	srv.ClaimAttempts = viper.GetInt("claim.attempts")
+	srv.ListenerTTL = viper.GetDuration("claim.listener_ttl")
+	if viper.IsSet("claim.fallback") {
+		var cfg fallback.Config
+		if err := viper.UnmarshalKey("claim.fallback", &cfg); err != nil {
+			return err
+		}
+		srv.ClaimFallback = cfg.Policy(viper.GetString("ari.application"))
+	}
+
+	if size := viper.GetInt("events.buffer_size"); size > 0 {
+		srv.EventBuffer = eventbuf.New(size)
+	} else {
+		srv.EventBuffer = nil
+	}
+
+	if viper.IsSet("events.filter") {
+		var cfg eventfilter.Config
+		if err := viper.UnmarshalKey("events.filter", &cfg); err != nil {
+			return err
+		}
+		srv.EventFilter = eventfilter.New(cfg.Rule(viper.GetString("ari.application")))
+	}
+
+	if viper.IsSet("ratelimit") {
+		var cfg ratelimit.Config
+		if err := viper.UnmarshalKey("ratelimit", &cfg); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		srv.RateLimit = ratelimit.New(cfg)
+	}
+
 	log.Info("starting ari-proxy server", "version", version)
 	return srv.Listen(ctx, &native.Options{
 		Application:  viper.GetString("ari.application"),
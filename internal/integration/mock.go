@@ -22,6 +22,7 @@ type mock struct {
 	Modules       *arimocks.Modules
 	Playback      *arimocks.Playback
 	Sound         *arimocks.Sound
+	TextMessage   *arimocks.TextMessage
 
 	AllSub          *arimocks.Subscription
 	AllEventChannel <-chan ari.Event
@@ -47,6 +48,7 @@ func standardMock() *mock {
 	m.Modules = &arimocks.Modules{}
 	m.Playback = &arimocks.Playback{}
 	m.Sound = &arimocks.Sound{}
+	m.TextMessage = &arimocks.TextMessage{}
 
 	m.AllSub = &arimocks.Subscription{}
 
@@ -71,6 +73,7 @@ func standardMock() *mock {
 	m.Asterisk.On("Modules").Return(m.Modules)
 	m.Client.On("Playback").Return(m.Playback)
 	m.Client.On("Sound").Return(m.Sound)
+	m.Client.On("TextMessage").Return(m.TextMessage)
 
 	m.Asterisk.On("Info", (*ari.Key)(nil)).Return(&ari.AsteriskInfo{
 		SystemInfo: ari.SystemInfo{
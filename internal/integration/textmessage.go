@@ -0,0 +1,65 @@
+package integration
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestTextMessageSend(t *testing.T, s Server) {
+	vars := map[string]string{"X-Custom": "1"}
+
+	runTest("ok", t, s, func(t *testing.T, m *mock, cl ari.Client) {
+		m.TextMessage.On("Send", "pjsip:me", "PJSIP", "1000", "hello", vars).Return(nil)
+
+		if err := cl.TextMessage().Send("pjsip:me", "PJSIP", "1000", "hello", vars); err != nil {
+			t.Errorf("Unexpected error in remote Send call: %s", err)
+		}
+
+		m.Shutdown()
+
+		m.TextMessage.AssertCalled(t, "Send", "pjsip:me", "PJSIP", "1000", "hello", vars)
+		m.TextMessage.AssertNumberOfCalls(t, "Send", 1)
+	})
+
+	runTest("err", t, s, func(t *testing.T, m *mock, cl ari.Client) {
+		m.TextMessage.On("Send", "pjsip:me", "PJSIP", "1000", "hello", vars).Return(errors.New("error"))
+
+		if err := cl.TextMessage().Send("pjsip:me", "PJSIP", "1000", "hello", vars); err == nil {
+			t.Errorf("Expected error in remote Send call")
+		}
+
+		m.Shutdown()
+
+		m.TextMessage.AssertCalled(t, "Send", "pjsip:me", "PJSIP", "1000", "hello", vars)
+	})
+}
+
+func TestTextMessageSendByURI(t *testing.T, s Server) {
+	var vars map[string]string
+
+	runTest("ok", t, s, func(t *testing.T, m *mock, cl ari.Client) {
+		m.TextMessage.On("SendByURI", "pjsip:me", "pjsip:1000@example.com", "hello", vars).Return(nil)
+
+		if err := cl.TextMessage().SendByURI("pjsip:me", "pjsip:1000@example.com", "hello", vars); err != nil {
+			t.Errorf("Unexpected error in remote SendByURI call: %s", err)
+		}
+
+		m.Shutdown()
+
+		m.TextMessage.AssertCalled(t, "SendByURI", "pjsip:me", "pjsip:1000@example.com", "hello", vars)
+	})
+
+	runTest("err", t, s, func(t *testing.T, m *mock, cl ari.Client) {
+		m.TextMessage.On("SendByURI", "pjsip:me", "pjsip:1000@example.com", "hello", vars).Return(errors.New("error"))
+
+		if err := cl.TextMessage().SendByURI("pjsip:me", "pjsip:1000@example.com", "hello", vars); err == nil {
+			t.Errorf("Expected error in remote SendByURI call")
+		}
+
+		m.Shutdown()
+
+		m.TextMessage.AssertCalled(t, "SendByURI", "pjsip:me", "pjsip:1000@example.com", "hello", vars)
+	})
+}
@@ -0,0 +1,118 @@
+package messagebus
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultMaxPayload is the default maximum size of a response message, beyond
+// which responses are chunked
+var DefaultMaxPayload = 1024 * 1024
+
+// chunkOverhead is the room left in each chunk message for the Response which
+// wraps the chunk
+const chunkOverhead = 1024
+
+// encodeResponse encodes the response in the codec as a single message or, if
+// it is larger than max bytes, as a sequence of chunk messages of at most max
+// bytes each
+func encodeResponse(codec Codec, msg *proxy.Response, max int) ([][]byte, error) {
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if max <= 0 {
+		max = DefaultMaxPayload
+	}
+	if len(data) <= max {
+		return [][]byte{data}, nil
+	}
+
+	// Chunk data is base64-encoded in JSON, which expands it by a third
+	size := (max - chunkOverhead) / 4 * 3
+	if size <= 0 {
+		return nil, eris.Errorf("maximum payload of %d bytes is too small to chunk responses", max)
+	}
+
+	id := rid.New("ck")
+	ret := make([][]byte, 0, len(data)/size+1)
+	for i := 0; len(data) > 0; i++ {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+
+		c, err := codec.Marshal(&proxy.Response{
+			Chunk: &proxy.Chunk{
+				ID:    id,
+				Index: i,
+				More:  n < len(data),
+				Data:  data[:n],
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+		data = data[n:]
+	}
+	return ret, nil
+}
+
+// chunkAssembler reassembles chunked responses.  The chunks of each response
+// must be received in order, but those of different responses may be
+// interleaved.  Each response is decoded in the codec of its chunks.
+type chunkAssembler struct {
+	partial map[string]*partialResponse
+}
+
+type partialResponse struct {
+	next int
+	data []byte
+}
+
+// add returns the response, if it is not chunked, or the reassembled
+// response, if it is the last chunk of one.  It returns nil if the response
+// is incomplete.
+func (a *chunkAssembler) add(codec Codec, resp *proxy.Response) (*proxy.Response, error) {
+	if resp == nil || resp.Chunk == nil {
+		return resp, nil
+	}
+	c := resp.Chunk
+
+	if a.partial == nil {
+		a.partial = make(map[string]*partialResponse)
+	}
+	p, ok := a.partial[c.ID]
+	if !ok {
+		p = &partialResponse{}
+		a.partial[c.ID] = p
+	}
+	if c.Index != p.next {
+		delete(a.partial, c.ID)
+		return nil, eris.Errorf("received chunk %d of response %s when expecting chunk %d", c.Index, c.ID, p.next)
+	}
+	p.next++
+	p.data = append(p.data, c.Data...)
+
+	if c.More {
+		return nil, nil
+	}
+	delete(a.partial, c.ID)
+
+	ret := new(proxy.Response)
+	if err := codec.Unmarshal(p.data, ret); err != nil {
+		return nil, eris.Wrap(err, "failed to decode chunked response")
+	}
+	return ret, nil
+}
+
+// addData decodes the message in the codec and passes it to add
+func (a *chunkAssembler) addData(codec Codec, data []byte) (*proxy.Response, error) {
+	resp := new(proxy.Response)
+	if err := codec.Unmarshal(data, resp); err != nil {
+		return nil, err
+	}
+	return a.add(codec, resp)
+}
@@ -0,0 +1,73 @@
+package messagebus
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestChunkedResponse(t *testing.T) {
+	resp := &proxy.Response{}
+	for i := 0; i < 500; i++ {
+		resp.Keys = append(resp.Keys, ari.NewKey(ari.SoundKey, fmt.Sprintf("sound-%d", i)))
+	}
+
+	small, err := encodeResponse(JSONCodec, &proxy.Response{Error: "small"}, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(small) != 1 {
+		t.Fatalf("expected a small response to be sent whole, got %d messages", len(small))
+	}
+
+	msgs, err := encodeResponse(JSONCodec, resp, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) < 2 {
+		t.Fatalf("expected a large response to be chunked, got %d messages", len(msgs))
+	}
+
+	other, err := encodeResponse(JSONCodec, &proxy.Response{Keys: resp.Keys[:200]}, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Chunks of different responses may be interleaved
+	var a chunkAssembler
+	var got []*proxy.Response
+	for i := 0; i < len(msgs) || i < len(other); i++ {
+		for _, list := range [][][]byte{msgs, other} {
+			if i >= len(list) {
+				continue
+			}
+			if len(list[i]) > 4096 {
+				t.Errorf("message of %d bytes exceeds maximum payload", len(list[i]))
+			}
+			r, err := a.addData(JSONCodec, list[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r != nil {
+				got = append(got, r)
+			}
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 reassembled responses, got %d", len(got))
+	}
+	want, _ := json.Marshal(resp)            // nolint: errcheck
+	have, _ := json.Marshal(got[len(got)-1]) // nolint: errcheck
+	if len(got[0].Keys) != 200 || string(want) != string(have) {
+		t.Error("reassembled responses differ from the originals")
+	}
+
+	// Missing chunks are detected
+	if _, err := a.addData(JSONCodec, msgs[1]); err == nil {
+		t.Error("expected an out of order chunk to be rejected")
+	}
+}
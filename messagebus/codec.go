@@ -0,0 +1,135 @@
+package messagebus
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// Codec encodes and decodes the requests, responses and events sent over the
+// MessageBus.  Announcements and pings are always encoded as JSON, so that
+// proxies and clients may discover the codecs supported by each other.
+type Codec interface {
+	// Name identifies the codec in announcements and configuration
+	Name() string
+
+	// ContentType is the content type of the messages encoded by the codec
+	ContentType() string
+
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default Codec, which encodes messages as JSON
+var JSONCodec Codec = jsonCodec{}
+
+// MsgpackCodec encodes messages as msgpack, using the field names of their
+// JSON encoding
+var MsgpackCodec Codec = msgpackCodec{}
+
+// Codecs are the supported codecs, all of which may be decoded by the ARI
+// proxy
+var Codecs = []Codec{JSONCodec, MsgpackCodec}
+
+// CodecByName returns the codec of the given name, or nil if it is not
+// supported.  The empty name is that of the JSONCodec.
+func CodecByName(name string) Codec {
+	if name == "" {
+		return JSONCodec
+	}
+	for _, c := range Codecs {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// CodecNames returns the names of the supported codecs
+func CodecNames() []string {
+	ret := make([]string, len(Codecs))
+	for i, c := range Codecs {
+		ret[i] = c.Name()
+	}
+	return ret
+}
+
+// codecByContentType returns the codec of the given content type, defaulting
+// to the JSONCodec
+func codecByContentType(contentType string) Codec {
+	for _, c := range Codecs {
+		if c.ContentType() == contentType {
+			return c
+		}
+	}
+	return JSONCodec
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string                          { return "msgpack" }
+func (msgpackCodec) ContentType() string                   { return "application/msgpack" }
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) { return proxy.MsgpackMarshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return proxy.MsgpackUnmarshal(data, v)
+}
+
+// codecReply tags the reply subject of a request with the codec in which it
+// was encoded, so that the response may be encoded in the same codec.  The
+// tagged subject is handed to the RequestHandler, which passes it on, opaque,
+// to PublishResponse.  Replies to JSON requests are not tagged.
+func codecReply(c Codec, reply string) string {
+	if c == JSONCodec || reply == "" {
+		return reply
+	}
+	return c.Name() + ";" + reply
+}
+
+// replyCodec splits a reply subject tagged by codecReply into its codec and
+// the original subject
+func replyCodec(topic string) (Codec, string) {
+	if i := strings.IndexByte(topic, ';'); i > 0 {
+		if c := CodecByName(topic[:i]); c != nil {
+			return c, topic[i+1:]
+		}
+	}
+	return JSONCodec, topic
+}
+
+// codecSelector holds the codec with which a MessageBus encodes the messages
+// it originates
+type codecSelector struct {
+	mu    sync.RWMutex
+	codec Codec
+}
+
+// SetCodec sets the codec with which requests are encoded.  Responses are
+// encoded in the codec of their request.
+func (s *codecSelector) SetCodec(c Codec) {
+	s.mu.Lock()
+	s.codec = c
+	s.mu.Unlock()
+}
+
+// getCodec returns the codec which has been set, or else that of the config
+func (s *codecSelector) getCodec(cfg Config) Codec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.codec != nil {
+		return s.codec
+	}
+	if cfg.Codec != nil {
+		return cfg.Codec
+	}
+	return JSONCodec
+}
@@ -0,0 +1,107 @@
+package messagebus
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestMsgpackEvent(t *testing.T) {
+	e := &proxy.SequencedEvent{
+		Event: &ari.StasisStart{
+			EventData: ari.EventData{
+				Type:        "StasisStart",
+				Application: "asdf",
+				Node:        "1",
+				Timestamp:   ari.DateTime(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)),
+			},
+			Args:    []string{"a", "b"},
+			Channel: ari.ChannelData{ID: "c1", State: "Up", ChannelVars: map[string]string{"x": "y"}},
+		},
+		EventSequence: proxy.EventSequence{Seq: 42, Boot: "boot"},
+	}
+
+	data, err := MsgpackCodec.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proxy.IsMsgpack(data) {
+		t.Fatal("expected the event to be encoded as a msgpack map")
+	}
+
+	got, err := proxy.DecodeSequencedEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Seq != 42 || got.Boot != "boot" {
+		t.Errorf("unexpected event sequence: %+v", got.EventSequence)
+	}
+
+	want, _ := json.Marshal(e)   // nolint: errcheck
+	have, _ := json.Marshal(got) // nolint: errcheck
+	if string(want) != string(have) {
+		t.Errorf("decoded event differs from the original:\n%s\n%s", want, have)
+	}
+
+	// Events which are not sequenced are encoded as themselves
+	if data, err = MsgpackCodec.Marshal(e.Event); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := proxy.DecodeEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ = json.Marshal(e.Event) // nolint: errcheck
+	have, _ = json.Marshal(plain)   // nolint: errcheck
+	if string(want) != string(have) {
+		t.Errorf("decoded event differs from the original:\n%s\n%s", want, have)
+	}
+}
+
+func TestMsgpackResponse(t *testing.T) {
+	c, reply := replyCodec(codecReply(MsgpackCodec, "_INBOX.abc"))
+	if c != MsgpackCodec || reply != "_INBOX.abc" {
+		t.Fatalf("unexpected reply codec %s for %s", c.Name(), reply)
+	}
+	if c, reply = replyCodec(codecReply(JSONCodec, "_INBOX.abc")); c != JSONCodec || reply != "_INBOX.abc" {
+		t.Fatalf("unexpected reply codec %s for %s", c.Name(), reply)
+	}
+
+	resp := &proxy.Response{
+		Data: &proxy.EntityData{
+			Channel: &ari.ChannelData{ID: "c1", Name: "PJSIP/a-0001"},
+		},
+	}
+	for i := 0; i < 300; i++ {
+		resp.Keys = append(resp.Keys, ari.NewKey(ari.ChannelKey, fmt.Sprintf("channel-%d", i)))
+	}
+
+	msgs, err := encodeResponse(MsgpackCodec, resp, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) < 2 {
+		t.Fatalf("expected a large response to be chunked, got %d messages", len(msgs))
+	}
+
+	var a chunkAssembler
+	var got *proxy.Response
+	for _, data := range msgs {
+		if got, err = a.addData(MsgpackCodec, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got == nil {
+		t.Fatal("expected the response to be reassembled")
+	}
+
+	want, _ := json.Marshal(resp) // nolint: errcheck
+	have, _ := json.Marshal(got)  // nolint: errcheck
+	if string(want) != string(have) {
+		t.Errorf("decoded response differs from the original:\n%s\n%s", want, have)
+	}
+}
@@ -48,6 +48,7 @@ type Server interface {
 	PublishResponse(topic string, msg *proxy.Response) error
 	PublishAnnounce(topic string, msg *proxy.Announcement) error
 	PublishEvent(topic string, msg ari.Event) error
+	PublishAudit(topic string, msg *proxy.AuditEntry) error
 }
 
 // Client defines the functions used on ari-proxy client
@@ -57,21 +58,45 @@ type Client interface {
 
 	SubscribeAnnounce(topic string, callback AnnounceHandler) (Subscription, error)
 	SubscribeEvent(topic string, queue string, callback EventHandler) (Subscription, error)
+	SubscribeQueue(topic string, queue string, callback EventHandler) (Subscription, error)
 
 	PublishPing(topic string) error
 	Request(topic string, req *proxy.Request) (*proxy.Response, error)
 	MultipleRequest(topic string, req *proxy.Request, expectedResp int) ([]*proxy.Response, error)
 	MultipleRequestReturnFirstGoodResponse(topic string, req *proxy.Request, expectedResp int) (*proxy.Response, error)
 
+	// SetCodec sets the codec in which requests are encoded
+	SetCodec(c Codec)
+
 	TimeoutCount() int64
 	GetWildcardString(w WildcardType) string
 }
 
+// SharedEventQueues indicates whether the subscriptions which the given client
+// makes by SubscribeEvent with the same queue share the events among them,
+// rather than each receiving every event
+func SharedEventQueues(c Client) bool {
+	s, ok := c.(interface{ SharedEventQueues() bool })
+	return ok && s.SharedEventQueues()
+}
+
 // Config has general configuration for MessageBus
 type Config struct {
 	URL            string
 	TimeoutRetries int
 	RequestTimeout time.Duration
+
+	// MaxPayload is the maximum size of a response message.  Larger responses
+	// are sent as a sequence of chunks, which are reassembled by the
+	// requester.  It defaults to the maximum payload of the NATS server or
+	// to DefaultMaxPayload.
+	MaxPayload int
+
+	// Codec is the codec in which requests are encoded by clients and events
+	// are encoded by servers.  It defaults to the JSONCodec.  Servers decode
+	// requests in any of the supported Codecs and respond in the codec of the
+	// request.
+	Codec Codec
 }
 
 // Subscription defines subscription interface
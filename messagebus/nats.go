@@ -11,6 +11,12 @@ import (
 	"github.com/rotisserie/eris"
 )
 
+// contentTypeHeader is the header of NATS messages which identifies the codec
+// in which they are encoded.  It is set only on messages which are not
+// encoded as JSON, so that JSON messages may still be exchanged through NATS
+// servers which do not support headers.
+const contentTypeHeader = "Content-Type"
+
 // NatsBus is MessageBus implementation for RabbitMQ
 type NatsBus struct {
 	Config Config
@@ -18,6 +24,8 @@ type NatsBus struct {
 
 	conn          *nats.EncodedConn
 	countTimeouts int64
+
+	codecSelector
 }
 
 // OptionNatsFunc options for RabbitMQ
@@ -44,6 +52,7 @@ func NewNatsBus(config Config, options ...OptionNatsFunc) *NatsBus {
 
 	mbus := NatsBus{
 		Config: config,
+		Log:    log15.New(),
 	}
 
 	for _, optfn := range options {
@@ -90,7 +99,7 @@ func (n *NatsBus) SubscribePing(topic string, callback PingHandler) (Subscriptio
 
 // SubscribeRequest subscribe request messages
 func (n *NatsBus) SubscribeRequest(topic string, callback RequestHandler) (Subscription, error) {
-	return n.conn.Subscribe(topic, callback)
+	return n.conn.Conn.Subscribe(topic, n.requestHandler(callback))
 }
 
 // SubscribeRequests subscribe request messages using multiple topics
@@ -98,7 +107,7 @@ func (n *NatsBus) SubscribeRequests(topics []string, callback RequestHandler) (S
 
 	subs := NatsMSubscription{}
 	for _, topic := range topics {
-		sub, err := n.conn.Subscribe(topic, callback)
+		sub, err := n.conn.Conn.Subscribe(topic, n.requestHandler(callback))
 		if err != nil {
 			subs.Unsubscribe() // nolint: errcheck
 			return nil, eris.Wrapf(err, "failed to create %s subscription", topic)
@@ -121,14 +130,92 @@ func (n *NatsBus) SubscribeEvent(topic string, queue string, callback EventHandl
 	})
 }
 
+// SubscribeQueue subscribe event messages, each of which is delivered to only one member of the queue group
+func (n *NatsBus) SubscribeQueue(topic string, queue string, callback EventHandler) (Subscription, error) {
+	return n.conn.QueueSubscribe(topic, queue, func(m *nats.Msg) {
+		callback(m.Data)
+	})
+}
+
 // SubscribeCreateRequest subscribe create request messages
 func (n *NatsBus) SubscribeCreateRequest(topic string, queue string, callback RequestHandler) (Subscription, error) {
-	return n.conn.QueueSubscribe(topic, queue, callback)
+	return n.conn.Conn.QueueSubscribe(topic, queue, n.requestHandler(callback))
 }
 
-// PublishResponse sends response message
+// requestHandler returns a handler which decodes requests in the codec of
+// their content type.  The reply subjects of requests which are not JSON are
+// tagged with their codec, so that the response is encoded in the same codec.
+func (n *NatsBus) requestHandler(callback RequestHandler) nats.MsgHandler {
+	return func(m *nats.Msg) {
+		codec := msgCodec(m)
+
+		req := new(proxy.Request)
+		if err := codec.Unmarshal(m.Data, req); err != nil {
+			n.Log.Error("failed to decode request", "subject", m.Subject, "codec", codec.Name(), "error", err)
+			return
+		}
+		callback(m.Subject, codecReply(codec, m.Reply), req)
+	}
+}
+
+// msgCodec returns the codec in which the message is encoded
+func msgCodec(m *nats.Msg) Codec {
+	if m.Header == nil {
+		return JSONCodec
+	}
+	return codecByContentType(m.Header.Get(contentTypeHeader))
+}
+
+// publishMsg sends the data, which is encoded in the given codec
+func (n *NatsBus) publishMsg(subject, reply string, codec Codec, data []byte) error {
+	m := &nats.Msg{
+		Subject: subject,
+		Reply:   reply,
+		Data:    data,
+	}
+	if codec != JSONCodec {
+		m.Header = nats.Header{contentTypeHeader: []string{codec.ContentType()}}
+	}
+	return n.conn.Conn.PublishMsg(m)
+}
+
+// publish encodes the message in the given codec and sends it
+func (n *NatsBus) publish(subject, reply string, codec Codec, msg interface{}) error {
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return n.publishMsg(subject, reply, codec, data)
+}
+
+// PublishResponse sends response message, in chunks if it exceeds the
+// maximum payload, encoded in the codec of the request
 func (n *NatsBus) PublishResponse(topic string, msg *proxy.Response) error {
-	return n.conn.Publish(topic, msg)
+	codec, topic := replyCodec(topic)
+
+	msgs, err := encodeResponse(codec, msg, n.maxPayload())
+	if err != nil {
+		return err
+	}
+	for _, data := range msgs {
+		if err := n.publishMsg(topic, "", codec, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxPayload returns the maximum size of a response message
+func (n *NatsBus) maxPayload() int {
+	if n.Config.MaxPayload > 0 {
+		return n.Config.MaxPayload
+	}
+	if n.conn != nil && n.conn.Conn != nil {
+		if m := n.conn.Conn.MaxPayload(); m > 0 {
+			return int(m)
+		}
+	}
+	return DefaultMaxPayload
 }
 
 // PublishPing sends ping message
@@ -143,6 +230,11 @@ func (n *NatsBus) PublishAnnounce(topic string, msg *proxy.Announcement) error {
 
 // PublishEvent sends event message
 func (n *NatsBus) PublishEvent(topic string, msg ari.Event) error {
+	return n.publish(topic, "", n.getCodec(n.Config), msg)
+}
+
+// PublishAudit sends audit message
+func (n *NatsBus) PublishAudit(topic string, msg *proxy.AuditEntry) error {
 	return n.conn.Publish(topic, msg)
 }
 
@@ -167,9 +259,9 @@ func (n *NatsBus) GetWildcardString(w WildcardType) string {
 // Request sends a request message
 func (n *NatsBus) Request(topic string, req *proxy.Request) (*proxy.Response, error) {
 	var err error
-	var resp proxy.Response
+	var resp *proxy.Response
 	for i := 0; i <= n.Config.TimeoutRetries; i++ {
-		err = n.conn.Request(topic, req, &resp, n.Config.RequestTimeout)
+		resp, err = n.request(topic, req)
 		if err == nats.ErrTimeout {
 			n.countTimeouts++
 			continue
@@ -177,11 +269,48 @@ func (n *NatsBus) Request(topic string, req *proxy.Request) (*proxy.Response, er
 		if err != nil {
 			return nil, err
 		}
-		return &resp, nil
+		return resp, nil
 	}
 	return nil, err
 }
 
+// request sends a request message and waits for its response, reassembling
+// the response if it is chunked
+func (n *NatsBus) request(topic string, req *proxy.Request) (*proxy.Response, error) {
+	inbox := nats.NewInbox()
+
+	sub, err := n.conn.Conn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to subscribe to response")
+	}
+	defer sub.Unsubscribe() // nolint: errcheck
+
+	codec := n.getCodec(n.Config)
+	if err := n.publish(topic, inbox, codec, req); err != nil {
+		return nil, eris.Wrap(err, "failed to make request")
+	}
+
+	var chunks chunkAssembler
+	deadline := time.Now().Add(n.Config.RequestTimeout)
+	for {
+		m, err := sub.NextMsg(time.Until(deadline))
+		if err != nil {
+			return nil, err
+		}
+		if len(m.Data) == 0 && m.Header.Get("Status") == "503" {
+			return nil, nats.ErrNoResponders
+		}
+
+		resp, err := chunks.addData(msgCodec(m), m.Data)
+		if err != nil {
+			return nil, err
+		}
+		if resp != nil {
+			return resp, nil
+		}
+	}
+}
+
 // MultipleRequest sends a request message to multiple consumers
 func (n *NatsBus) MultipleRequest(topic string, req *proxy.Request, expectedResp int) ([]*proxy.Response, error) {
 	var responses []*proxy.Response
@@ -193,14 +322,16 @@ func (n *NatsBus) MultipleRequest(topic string, req *proxy.Request, expectedResp
 		fwdChan:  make(chan *proxy.Response),
 	}
 
-	replySub, err := n.conn.Subscribe(reply, rf.Forward)
+	replySub, err := n.conn.Conn.Subscribe(reply, func(m *nats.Msg) {
+		rf.Forward(msgCodec(m), m.Data)
+	})
 	if err != nil {
 		return nil, eris.Wrap(err, "failed to subscribe to data responses")
 	}
 	defer replySub.Unsubscribe() // nolint: errcheck
 
 	// Make an all-call for the entity data
-	err = n.conn.PublishRequest(topic, reply, req)
+	err = n.publish(topic, reply, n.getCodec(n.Config), req)
 	if err != nil {
 		return nil, eris.Wrap(err, "failed to make request for data")
 	}
@@ -231,14 +362,16 @@ func (n *NatsBus) MultipleRequestReturnFirstGoodResponse(topic string, req *prox
 		fwdChan:  make(chan *proxy.Response),
 	}
 
-	replySub, err := n.conn.Subscribe(reply, rf.Forward)
+	replySub, err := n.conn.Conn.Subscribe(reply, func(m *nats.Msg) {
+		rf.Forward(msgCodec(m), m.Data)
+	})
 	if err != nil {
 		return nil, eris.Wrap(err, "failed to subscribe to data responses")
 	}
 	defer replySub.Unsubscribe() // nolint: errcheck
 
 	// Make an all-call for the entity data
-	err = n.conn.PublishRequest(topic, reply, req)
+	err = n.publish(topic, reply, n.getCodec(n.Config), req)
 	if err != nil {
 		return nil, eris.Wrap(err, "failed to make request for data")
 	}
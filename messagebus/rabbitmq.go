@@ -26,6 +26,8 @@ const (
 	exchangePing     = "ari.ping"
 	exchangeAnnounce = "ari.announce"
 	exchangeRequest  = "ari.request"
+	exchangeAudit    = "ari.audit"
+	exchangePresence = "ari.presence"
 
 	// type of identifiers
 	ridConsumer    = "co"
@@ -43,7 +45,10 @@ type RabbitmqBus struct {
 	channel       *amqp091.Channel
 	countTimeouts int64
 	isClosed      bool
+	declared      map[string]bool
 	mu            sync.RWMutex
+
+	codecSelector
 }
 
 // OptionRabbitmqFunc options for RabbitMQ
@@ -110,13 +115,7 @@ func (r *RabbitmqBus) Connect() error {
 // SubscribePing subscribe ping messages
 func (r *RabbitmqBus) SubscribePing(topic string, callback PingHandler) (Subscription, error) {
 
-	sub := RmqSubscription{
-		Topics:       []string{topic},
-		Queue:        exchangePing + "-" + rid.New(ridQueue),
-		Exchange:     exchangePing,
-		ExchangeKind: amqp091.ExchangeFanout,
-		QueueArgs:    amqp091.Table{"x-expires": DefaultQueueExpire},
-	}
+	sub := pingSubscription(topic)
 
 	d, err := sub.execute(r)
 	if err != nil {
@@ -139,7 +138,7 @@ func (r *RabbitmqBus) SubscribePing(topic string, callback PingHandler) (Subscri
 		}
 	}(d)
 
-	return &sub, nil
+	return sub, nil
 }
 
 // SubscribeRequest subscribe request messages
@@ -168,12 +167,13 @@ func (r *RabbitmqBus) SubscribeRequest(topic string, callback RequestHandler) (S
 
 				//callback
 				var data proxy.Request
-				err = json.Unmarshal(msg.Body, &data)
+				codec := codecByContentType(msg.ContentType)
+				err = codec.Unmarshal(msg.Body, &data)
 				if err != nil {
 					r.Log.Error("Error unmarshall data", "topic", topic, "error", err)
 					continue
 				}
-				callback(topic, msg.ReplyTo, &data)
+				callback(topic, codecReply(codec, msg.ReplyTo), &data)
 			}
 			if r.isClosed {
 				return
@@ -211,12 +211,13 @@ func (r *RabbitmqBus) SubscribeRequests(topics []string, callback RequestHandler
 
 				//callback
 				var data proxy.Request
-				err = json.Unmarshal(msg.Body, &data)
+				codec := codecByContentType(msg.ContentType)
+				err = codec.Unmarshal(msg.Body, &data)
 				if err != nil {
 					r.Log.Error("Error unmarshall data", "topics", topics, "error", err)
 					continue
 				}
-				callback(msg.RoutingKey, msg.ReplyTo, &data)
+				callback(msg.RoutingKey, codecReply(codec, msg.ReplyTo), &data)
 			}
 			if r.isClosed {
 				return
@@ -308,6 +309,11 @@ func (r *RabbitmqBus) SubscribeEvent(topic string, queue string, callback EventH
 	return &sub, nil
 }
 
+// SubscribeQueue subscribe event messages, each of which is delivered to only one consumer of the queue
+func (r *RabbitmqBus) SubscribeQueue(topic string, queue string, callback EventHandler) (Subscription, error) {
+	return r.SubscribeEvent(topic, queue, callback)
+}
+
 // SubscribeCreateRequest subscribe create request messages
 func (r *RabbitmqBus) SubscribeCreateRequest(topic string, queue string, callback RequestHandler) (Subscription, error) {
 	sub := RmqSubscription{
@@ -332,12 +338,13 @@ func (r *RabbitmqBus) SubscribeCreateRequest(topic string, queue string, callbac
 
 				//callback
 				var data proxy.Request
-				err = json.Unmarshal(msg.Body, &data)
+				codec := codecByContentType(msg.ContentType)
+				err = codec.Unmarshal(msg.Body, &data)
 				if err != nil {
 					r.Log.Error("Error unmarshal data", "topic", topic, "error", err)
 					continue
 				}
-				callback(topic, msg.ReplyTo, &data)
+				callback(topic, codecReply(codec, msg.ReplyTo), &data)
 			}
 			if r.isClosed {
 				return
@@ -349,14 +356,21 @@ func (r *RabbitmqBus) SubscribeCreateRequest(topic string, queue string, callbac
 	return &sub, nil
 }
 
-// PublishResponse sends response message
+// PublishResponse sends response message, encoded in the codec of the request
 func (r *RabbitmqBus) PublishResponse(topic string, msg *proxy.Response) error {
-	data, err := json.Marshal(msg)
+	codec, topic := replyCodec(topic)
+
+	msgs, err := encodeResponse(codec, msg, r.Config.MaxPayload)
 	if err != nil {
 		return err
 	}
-	//exchange should be empty
-	return r.publish(topic, "", data)
+	for _, data := range msgs {
+		//exchange should be empty
+		if err := r.publish(topic, "", codec.ContentType(), data); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // PublishPing sends ping message
@@ -365,7 +379,11 @@ func (r *RabbitmqBus) PublishPing(topic string) error {
 	if err != nil {
 		return err
 	}
-	return r.publish(topic, topic, data)
+	exchange, kind := pingExchange(topic)
+	if err = r.declareExchange(exchange, kind); err != nil {
+		return eris.Wrap(err, "failed to declare ping exchange")
+	}
+	return r.publish(topic, exchange, JSONCodec.ContentType(), data)
 }
 
 // PublishAnnounce sends announce message
@@ -374,20 +392,33 @@ func (r *RabbitmqBus) PublishAnnounce(topic string, msg *proxy.Announcement) err
 	if err != nil {
 		return err
 	}
-	return r.publish(topic, topic, data)
+	return r.publish(topic, topic, JSONCodec.ContentType(), data)
 
 }
 
 // PublishEvent sends event message
 func (r *RabbitmqBus) PublishEvent(topic string, msg ari.Event) error {
-	data, err := json.Marshal(msg)
+	codec := r.getCodec(r.Config)
+	data, err := codec.Marshal(msg)
 	if err != nil {
 		return err
 	}
-	return r.publish(topic, exchangeEvent, data)
+	return r.publish(topic, exchangeEvent, codec.ContentType(), data)
 
 }
 
+// PublishAudit sends audit message
+func (r *RabbitmqBus) PublishAudit(topic string, msg *proxy.AuditEntry) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err = r.declareExchange(exchangeAudit, amqp091.ExchangeTopic); err != nil {
+		return eris.Wrap(err, "failed to declare audit exchange")
+	}
+	return r.publish(topic, exchangeAudit, JSONCodec.ContentType(), data)
+}
+
 // Close closes the connection
 func (r *RabbitmqBus) Close() {
 	r.mu.Lock()
@@ -397,6 +428,13 @@ func (r *RabbitmqBus) Close() {
 	r.conn.Close() // nolint: errcheck
 }
 
+// SharedEventQueues indicates that event subscriptions with the same queue
+// consume from a single RabbitMQ queue, among whose consumers the events are
+// divided
+func (r *RabbitmqBus) SharedEventQueues() bool {
+	return true
+}
+
 // GetWildcardString returns wildcard based on type
 func (r *RabbitmqBus) GetWildcardString(w WildcardType) string {
 	switch w {
@@ -410,9 +448,8 @@ func (r *RabbitmqBus) GetWildcardString(w WildcardType) string {
 
 // Request sends a request message
 func (r *RabbitmqBus) Request(topic string, req *proxy.Request) (*proxy.Response, error) {
-	var resp proxy.Response
-
-	requestData, err := json.Marshal(req)
+	codec := r.getCodec(r.Config)
+	requestData, err := codec.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
@@ -450,7 +487,7 @@ func (r *RabbitmqBus) Request(topic string, req *proxy.Request) (*proxy.Response
 			false,           // mandatory
 			false,           // immediate
 			amqp091.Publishing{
-				ContentType:   "application/json",
+				ContentType:   codec.ContentType(),
 				CorrelationId: rid.New(ridCorrelation),
 				Body:          requestData,
 				ReplyTo:       "amq.rabbitmq.reply-to",
@@ -466,13 +503,18 @@ func (r *RabbitmqBus) Request(topic string, req *proxy.Request) (*proxy.Response
 		return nil, eris.Wrap(err, "failed to publish message")
 	}
 
-	msg := <-msgs
-	if err := json.Unmarshal(msg.Body, &resp); err != nil {
-		r.Log.Error("Error on Unmarshal response", "topic", topic, "error", err)
-		return nil, err
+	var chunks chunkAssembler
+	for {
+		msg := <-msgs
+		resp, err := chunks.addData(codecByContentType(msg.ContentType), msg.Body)
+		if err != nil {
+			r.Log.Error("Error on Unmarshal response", "topic", topic, "error", err)
+			return nil, err
+		}
+		if resp != nil {
+			return resp, nil
+		}
 	}
-	return &resp, nil
-
 }
 
 // MultipleRequest sends a request message to multiple consumers
@@ -480,7 +522,8 @@ func (r *RabbitmqBus) MultipleRequest(topic string, req *proxy.Request, expected
 
 	responses := make([]*proxy.Response, 0, expectedResp)
 
-	requestData, err := json.Marshal(req)
+	codec := r.getCodec(r.Config)
+	requestData, err := codec.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
@@ -516,7 +559,7 @@ func (r *RabbitmqBus) MultipleRequest(topic string, req *proxy.Request, expected
 			false,           // mandatory
 			false,           // immediate
 			amqp091.Publishing{
-				ContentType:   "application/json",
+				ContentType:   codec.ContentType(),
 				CorrelationId: rid.New(ridCorrelation),
 				Body:          requestData,
 				ReplyTo:       "amq.rabbitmq.reply-to",
@@ -534,6 +577,7 @@ func (r *RabbitmqBus) MultipleRequest(topic string, req *proxy.Request, expected
 	timer := time.NewTimer(r.Config.RequestTimeout)
 	defer timer.Stop()
 	responseCount := 0
+	var chunks chunkAssembler
 	for {
 		select {
 		case <-timer.C:
@@ -542,12 +586,16 @@ func (r *RabbitmqBus) MultipleRequest(topic string, req *proxy.Request, expected
 			if !more {
 				return responses, nil
 			}
-			var resp proxy.Response
-			if err := json.Unmarshal(msg.Body, &resp); err != nil {
+			resp, err := chunks.addData(codecByContentType(msg.ContentType), msg.Body)
+			if err != nil {
 				r.Log.Error("Error on Unmarshal response", "topic", topic, "error", err)
 				return nil, err
 			}
-			responses = append(responses, &resp)
+			if resp == nil {
+				// Wait for the rest of the chunked response
+				continue
+			}
+			responses = append(responses, resp)
 			responseCount++
 			if responseCount >= expectedResp {
 				return responses, nil
@@ -559,7 +607,8 @@ func (r *RabbitmqBus) MultipleRequest(topic string, req *proxy.Request, expected
 // MultipleRequestReturnFirstGoodResponse sends a request message to multiple consumers and returns the first good response
 func (r *RabbitmqBus) MultipleRequestReturnFirstGoodResponse(topic string, req *proxy.Request, expectedResp int) (*proxy.Response, error) {
 
-	requestData, err := json.Marshal(req)
+	codec := r.getCodec(r.Config)
+	requestData, err := codec.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
@@ -595,7 +644,7 @@ func (r *RabbitmqBus) MultipleRequestReturnFirstGoodResponse(topic string, req *
 			false,           // mandatory
 			false,           // immediate
 			amqp091.Publishing{
-				ContentType:   "application/json",
+				ContentType:   codec.ContentType(),
 				CorrelationId: rid.New(ridCorrelation),
 				Body:          requestData,
 				ReplyTo:       "amq.rabbitmq.reply-to",
@@ -613,6 +662,7 @@ func (r *RabbitmqBus) MultipleRequestReturnFirstGoodResponse(topic string, req *
 	timer := time.NewTimer(r.Config.RequestTimeout)
 	defer timer.Stop()
 	responseCount := 0
+	var chunks chunkAssembler
 	for {
 		select {
 		case <-timer.C:
@@ -631,14 +681,18 @@ func (r *RabbitmqBus) MultipleRequestReturnFirstGoodResponse(topic string, req *
 				return nil, err
 			}
 
-			var resp proxy.Response
-			if err = json.Unmarshal(msg.Body, &resp); err != nil {
+			var resp *proxy.Response
+			if resp, err = chunks.addData(codecByContentType(msg.ContentType), msg.Body); err != nil {
 				r.Log.Error("Error on Unmarshal response", "topic", topic, "error", err)
 				continue
 			}
+			if resp == nil {
+				// Wait for the rest of the chunked response
+				continue
+			}
 
 			if err = resp.Err(); err == nil { // store the error for later return
-				return &resp, nil // No error means to return the current value
+				return resp, nil // No error means to return the current value
 			}
 
 			responseCount++
@@ -665,7 +719,7 @@ func (r *RabbitmqBus) connect() error {
 	return nil
 }
 
-func (r *RabbitmqBus) publish(topic string, exchange string, data []byte) error {
+func (r *RabbitmqBus) publish(topic string, exchange string, contentType string, data []byte) error {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -677,7 +731,7 @@ func (r *RabbitmqBus) publish(topic string, exchange string, data []byte) error
 		false,
 		amqp091.Publishing{
 			Headers:         amqp091.Table{},
-			ContentType:     "application/json",
+			ContentType:     contentType,
 			ContentEncoding: "",
 			Body:            data,
 			DeliveryMode:    amqp091.Transient, // 1=non-persistent, 2=persistent
@@ -685,6 +739,62 @@ func (r *RabbitmqBus) publish(topic string, exchange string, data []byte) error
 		})
 }
 
+// pingExchange returns the exchange, and its kind, through which the pings to
+// the given topic are sent.  Pings to the ping subject are fanned out on the
+// ping exchange, while the others, such as the announcements of listeners, are
+// routed by their topic, so that each reaches only the subscribers to its own
+// topic.
+func pingExchange(topic string) (string, string) {
+	if topic == exchangePing {
+		return exchangePing, amqp091.ExchangeFanout
+	}
+	return exchangePresence, amqp091.ExchangeTopic
+}
+
+// pingSubscription returns the subscription to the pings to the given topic,
+// each subscriber receiving all of them
+func pingSubscription(topic string) *RmqSubscription {
+	exchange, kind := pingExchange(topic)
+	return &RmqSubscription{
+		Topics:       []string{topic},
+		Queue:        exchange + "-" + rid.New(ridQueue),
+		Exchange:     exchange,
+		ExchangeKind: kind,
+		QueueArgs:    amqp091.Table{"x-expires": DefaultQueueExpire},
+	}
+}
+
+// declareExchange declares the given exchange, if it has not already been
+// declared by this bus.  Publishing to an undeclared exchange would close the
+// shared publishing channel.
+func (r *RabbitmqBus) declareExchange(name string, kind string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.declared[name] {
+		return nil
+	}
+
+	err := r.channel.ExchangeDeclare(
+		name,  // name of exchange
+		kind,  // kind
+		true,  // durable
+		false, // delete when unused
+		false, // internal
+		false, // nowait
+		nil,   // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	if r.declared == nil {
+		r.declared = make(map[string]bool)
+	}
+	r.declared[name] = true
+	return nil
+}
+
 func (r *RabbitmqBus) newChannel() (*amqp091.Channel, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
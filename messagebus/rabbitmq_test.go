@@ -0,0 +1,34 @@
+package messagebus
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestRabbitmqPingRouting(t *testing.T) {
+	ping := proxy.PingSubject("ari.")
+	if exchange, kind := pingExchange(ping); exchange != exchangePing || kind != amqp091.ExchangeFanout {
+		t.Errorf("unexpected exchange for pings: %s (%s)", exchange, kind)
+	}
+
+	listener := proxy.ListenerSubject("ari.", "app")
+	exchange, kind := pingExchange(listener)
+	if exchange == exchangePing || kind != amqp091.ExchangeTopic {
+		t.Errorf("listener announcements should be routed by topic, got %s (%s)", exchange, kind)
+	}
+
+	// Subscribers receive the pings to their topic only, through the exchange
+	// to which they are published
+	sub := pingSubscription(listener)
+	if sub.Exchange != exchange || sub.ExchangeKind != kind {
+		t.Errorf("listener subscription is on %s (%s), not %s (%s)", sub.Exchange, sub.ExchangeKind, exchange, kind)
+	}
+	if len(sub.Topics) != 1 || sub.Topics[0] != listener {
+		t.Errorf("listener subscription is not bound to its topic: %v", sub.Topics)
+	}
+	if other := pingSubscription(proxy.ListenerSubject("ari.", "other")); other.Queue == sub.Queue {
+		t.Error("ping subscribers should not share a queue")
+	}
+}
@@ -11,15 +11,25 @@ type responseForwarder struct {
 	count    int
 	expected int
 	fwdChan  chan *proxy.Response
+	chunks   chunkAssembler
 
 	mu sync.Mutex
 }
 
-func (f *responseForwarder) Forward(o *proxy.Response) {
+func (f *responseForwarder) Forward(codec Codec, data []byte) {
 
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	// Wait for the rest of chunked responses
+	o, err := f.chunks.addData(codec, data)
+	if err != nil {
+		o = &proxy.Response{Error: err.Error()}
+	}
+	if o == nil {
+		return
+	}
+
 	f.count++
 
 	if f.closed {
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// AuditEntry describes the record of a single mutating (command or create)
+// request which was handled by an ARI proxy server.
+type AuditEntry struct {
+	// Timestamp is the time at which the request was received
+	Timestamp time.Time `json:"timestamp"`
+
+	// Node is the Asterisk ID of the proxy which handled the request
+	Node string `json:"node"`
+
+	// Application is the ARI application of the proxy which handled the request
+	Application string `json:"application"`
+
+	// Client is the identity of the client which issued the request, if known
+	Client string `json:"client,omitempty"`
+
+	// Class is the request class (command or create)
+	Class string `json:"class"`
+
+	// Kind is the kind of the request
+	Kind string `json:"kind"`
+
+	// Key is the key on which the request operated
+	Key *ari.Key `json:"key,omitempty"`
+
+	// Dialog is the dialog, if any, under which the request was made
+	Dialog string `json:"dialog,omitempty"`
+
+	// Payload is the (possibly redacted) request body
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// Error is the error returned to the client, if any.  An empty Error indicates success.
+	Error string `json:"error,omitempty"`
+
+	// Latency is the time taken to handle the request, in nanoseconds
+	Latency time.Duration `json:"latency"`
+}
+
+// AuditSubject returns the MessageBus subject on which audit entries for the given application and node are published
+func AuditSubject(prefix, appName, node string) string {
+	return fmt.Sprintf("%saudit.%s.%s", prefix, appName, node)
+}
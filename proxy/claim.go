@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// ClaimSubject returns the MessageBus subject on which an ARI proxy offers
+// the channels which enter Stasis to be claimed by a single listener
+func ClaimSubject(prefix, app, node string) string {
+	return fmt.Sprintf("%sclaim.%s.%s", prefix, app, node)
+}
+
+// ListenerSubject returns the MessageBus subject on which the listeners for
+// the channels of an ARI application announce their presence
+func ListenerSubject(prefix, app string) string {
+	return fmt.Sprintf("%slistener.%s", prefix, app)
+}
+
+// Claim describes an offer of a channel which has entered Stasis.  The
+// listener which takes the channel must claim it, using the Token, before the
+// offer expires.
+type Claim struct {
+	// Token identifies the offer
+	Token string `json:"proxy_claim_token,omitempty"`
+
+	// Attempt is the number of the offer, starting at 1
+	Attempt int `json:"proxy_claim_attempt,omitempty"`
+}
+
+// StasisOffer is a StasisStart event offered to be claimed.  It is encoded as
+// the event itself with the additional top-level fields of the Claim.
+type StasisOffer struct {
+	*ari.StasisStart
+
+	Claim
+}
+
+// MarshalJSON implements json.Marshaler
+func (o *StasisOffer) MarshalJSON() ([]byte, error) {
+	return marshalEventWith(o.StasisStart, o.Claim)
+}
+
+// DecodeStasisOffer decodes a StasisStart event along with the Claim by which
+// it is offered
+func DecodeStasisOffer(data []byte) (*StasisOffer, error) {
+	e, err := DecodeEvent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := e.(*ari.StasisStart)
+	if !ok {
+		return nil, eris.Errorf("unexpected event type %s", e.GetType())
+	}
+
+	ret := &StasisOffer{StasisStart: v}
+	if err := unmarshalEvent(data, &ret.Claim); err != nil {
+		return nil, eris.Wrap(err, "failed to decode claim")
+	}
+	return ret, nil
+}
+
+// ChannelClaim describes the claim of a channel offered by a StasisOffer
+type ChannelClaim struct {
+	// Token identifies the offer being claimed
+	Token string `json:"token"`
+}
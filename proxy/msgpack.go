@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func init() {
+	// ari.DateTime is a time.Time, which would otherwise be encoded as an
+	// empty struct
+	msgpack.Register(ari.DateTime{},
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			return e.EncodeTime(time.Time(v.Interface().(ari.DateTime)))
+		},
+		func(d *msgpack.Decoder, v reflect.Value) error {
+			t, err := d.DecodeTime()
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(ari.DateTime(t)))
+			return nil
+		},
+	)
+}
+
+// MsgpackMarshal encodes v as msgpack.  Struct fields are named by their JSON
+// tags, so that the msgpack encoding of a message has the same structure as
+// its JSON encoding.
+func MsgpackMarshal(v interface{}) ([]byte, error) {
+	if e, ok := v.(ari.Event); ok {
+		if _, custom := v.(msgpack.Marshaler); !custom {
+			return msgpackEventWith(e, nil)
+		}
+	}
+	return msgpackEncode(v)
+}
+
+// msgpackEncode encodes v as msgpack, naming struct fields by their JSON tags
+func msgpackEncode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MsgpackUnmarshal decodes the msgpack data into v
+func MsgpackUnmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// IsMsgpack indicates whether the encoded message is a msgpack map rather than
+// a JSON object
+func IsMsgpack(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	b := data[0]
+	return b&0xf0 == 0x80 || b == 0xde || b == 0xdf
+}
+
+// DecodeEvent decodes an event encoded as either JSON or msgpack
+func DecodeEvent(data []byte) (ari.Event, error) {
+	if !IsMsgpack(data) {
+		return ari.DecodeEvent(data)
+	}
+
+	var typer ari.Message
+	if err := MsgpackUnmarshal(data, &typer); err != nil {
+		return nil, eris.Wrap(err, "failed to decode type")
+	}
+	if typer.Type == "" {
+		return nil, eris.New("no type found")
+	}
+
+	// Let ari construct the concrete event type
+	stub, err := json.Marshal(&typer)
+	if err != nil {
+		return nil, err
+	}
+	e, err := ari.DecodeEvent(stub)
+	if err != nil {
+		return nil, err
+	}
+	if err := MsgpackUnmarshal(data, e); err != nil {
+		return nil, eris.Wrap(err, "failed to decode event")
+	}
+	return e, nil
+}
+
+// unmarshalEvent decodes the JSON or msgpack encoded event data into v
+func unmarshalEvent(data []byte, v interface{}) error {
+	if IsMsgpack(data) {
+		return MsgpackUnmarshal(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// MarshalMsgpack implements msgpack.Marshaler
+func (e *SequencedEvent) MarshalMsgpack() ([]byte, error) {
+	return msgpackEventWith(e.Event, e.EventSequence)
+}
+
+// MarshalMsgpack implements msgpack.Marshaler
+func (o *StasisOffer) MarshalMsgpack() ([]byte, error) {
+	return msgpackEventWith(o.StasisStart, o.Claim)
+}
+
+// eventTimestamp holds the timestamp of an event.  The Timestamp of
+// ari.EventData is an omitempty ari.DateTime, which the msgpack encoder would
+// always consider empty, so it is encoded separately.
+type eventTimestamp struct {
+	Timestamp time.Time `msgpack:"timestamp,omitempty"`
+}
+
+// msgpackEventWith encodes the event with the additional top-level fields of
+// extra, if it is not nil, as marshalEventWith does for JSON
+func msgpackEventWith(e ari.Event, extra interface{}) ([]byte, error) {
+	data, err := msgpackEncode(e)
+	if err != nil {
+		return nil, err
+	}
+	n, body, err := msgpackMap(data)
+	if err != nil {
+		return nil, eris.Wrap(err, "event is not encoded as a msgpack map")
+	}
+
+	var ts eventTimestamp
+	if v := reflect.Indirect(reflect.ValueOf(e)); v.Kind() == reflect.Struct {
+		if f := v.FieldByName("Timestamp"); f.IsValid() && f.Type() == reflect.TypeOf(ari.DateTime{}) {
+			ts.Timestamp = time.Time(f.Interface().(ari.DateTime))
+		}
+	}
+
+	ret := make([]byte, 5, 5+len(body))
+	for _, x := range []interface{}{extra, &ts} {
+		if x == nil {
+			continue
+		}
+		fields, err := msgpackEncode(x)
+		if err != nil {
+			return nil, err
+		}
+		m, extraBody, err := msgpackMap(fields)
+		if err != nil {
+			return nil, err
+		}
+		n += m
+		ret = append(ret, extraBody...)
+	}
+	ret = append(ret, body...)
+
+	// Prepend the header of the merged map
+	header := appendMsgpackMapHeader(nil, n)
+	ret = ret[5-len(header):]
+	copy(ret, header)
+	return ret, nil
+}
+
+// msgpackMap returns the number of entries and the encoded entries of a
+// msgpack map
+func msgpackMap(data []byte) (int, []byte, error) {
+	switch {
+	case len(data) > 0 && data[0]&0xf0 == 0x80:
+		return int(data[0] & 0x0f), data[1:], nil
+	case len(data) >= 3 && data[0] == 0xde:
+		return int(binary.BigEndian.Uint16(data[1:3])), data[3:], nil
+	case len(data) >= 5 && data[0] == 0xdf:
+		return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+	}
+	return 0, nil, eris.New("not a msgpack map")
+}
+
+// appendMsgpackMapHeader appends the header of a msgpack map of n entries
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= 0xffff:
+		b = append(b, 0xde)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	}
+	b = append(b, 0xdf)
+	return binary.BigEndian.AppendUint32(b, uint32(n))
+}
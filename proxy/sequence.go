@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// EventSequence describes the position of an event in the event stream of an
+// ARI proxy, which is that of a single node and application.  Sequence
+// numbers start at 1 with each boot of the proxy and increase by one with
+// each event published to the canonical event subjects.
+type EventSequence struct {
+	// Seq is the sequence number of the event
+	Seq uint64 `json:"proxy_seq,omitempty"`
+
+	// Boot identifies the run of the ARI proxy which published the event
+	Boot string `json:"proxy_boot,omitempty"`
+
+	// Offered indicates that the event is a StasisStart whose channel is also
+	// offered to be claimed (see StasisOffer), so that the listeners which
+	// take the offers do not handle the event itself as well
+	Offered bool `json:"proxy_offered,omitempty"`
+}
+
+// SequencedEvent is an ari.Event stamped with its EventSequence.  It is
+// encoded as the event itself with the additional top-level fields
+// "proxy_seq" and "proxy_boot", so that it may still be decoded by
+// ari.DecodeEvent.  SequencedEvents may also be encoded as msgpack.
+type SequencedEvent struct {
+	ari.Event
+
+	EventSequence
+}
+
+// MarshalJSON implements json.Marshaler
+func (e *SequencedEvent) MarshalJSON() ([]byte, error) {
+	return marshalEventWith(e.Event, e.EventSequence)
+}
+
+// marshalEventWith encodes the event with the additional top-level fields of
+// extra, which must encode as a JSON object
+func marshalEventWith(e ari.Event, extra interface{}) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := json.Marshal(extra)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' {
+		return nil, eris.New("event is not encoded as a JSON object")
+	}
+	if len(fields) <= 2 {
+		return data, nil
+	}
+
+	ret := make([]byte, 0, len(data)+len(fields))
+	ret = append(ret, fields[:len(fields)-1]...)
+	if len(bytes.TrimSpace(data[1:len(data)-1])) > 0 {
+		ret = append(ret, ',')
+	}
+	return append(ret, data[1:]...), nil
+}
+
+// DecodeSequencedEvent decodes an event along with any EventSequence with
+// which it was stamped.  Events which were not stamped have a zero
+// EventSequence.
+func DecodeSequencedEvent(data []byte) (*SequencedEvent, error) {
+	e, err := DecodeEvent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &SequencedEvent{Event: e}
+	if err := unmarshalEvent(data, &ret.EventSequence); err != nil {
+		return nil, eris.Wrap(err, "failed to decode event sequence")
+	}
+	return ret, nil
+}
@@ -1,6 +1,9 @@
 package proxy
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Subject returns the communication subject for the given parameters
 func Subject(prefix, class, appName, asterisk string) (ret string) {
@@ -13,3 +16,41 @@ func Subject(prefix, class, appName, asterisk string) (ret string) {
 	}
 	return
 }
+
+// TypedEventSubject returns the fine-grained subject for an event of the
+// given type.  If kind and id are given, the subject is that of the event for
+// the given entity; otherwise, it is that of the event itself.  Each
+// component is escaped by EscapeSubjectToken.
+//
+// Typed event subjects have the form:
+//
+//	<prefix>typedevent.<app>.<node>.<EventType>[.<entityKind>.<entityID>]
+func TypedEventSubject(prefix, app, node, eventType, kind, id string) string {
+	ret := fmt.Sprintf("%stypedevent.%s.%s.%s",
+		prefix,
+		EscapeSubjectToken(app),
+		EscapeSubjectToken(node),
+		EscapeSubjectToken(eventType),
+	)
+	if kind != "" && id != "" {
+		ret += "." + EscapeSubjectToken(kind) + "." + EscapeSubjectToken(id)
+	}
+	return ret
+}
+
+// EscapeSubjectToken escapes the given value for use as a single token of a
+// MessageBus subject.  All bytes other than ASCII letters, digits, '-' and '_'
+// are replaced by '%' followed by their hexadecimal value, so that the token
+// contains no separators or wildcards.
+func EscapeSubjectToken(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '-' || c == '_' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -21,6 +22,17 @@ type Announcement struct {
 
 	// Application indicates the ARI application as which the proxy is connected
 	Application string `json:"application"`
+
+	// Codecs lists the names of the codecs in which the proxy accepts
+	// requests.  Proxies which do not list any accept only JSON.
+	Codecs []string `json:"codecs,omitempty"`
+
+	// Version is the ProtocolVersion of the proxy
+	Version int `json:"version,omitempty"`
+
+	// Capabilities lists the optional features of the protocol which the
+	// proxy supports
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // AnnouncementSubject returns the MessageBus subject
@@ -33,6 +45,9 @@ func PingSubject(prefix string) string {
 	return fmt.Sprintf("%sping", prefix)
 }
 
+// DialogKey is the key kind by which dialogs are identified in responses to dialog requests
+const DialogKey = "dialog"
+
 // EntityData is a response which returns the data for a specific entity.
 type EntityData struct {
 	Application     *ari.ApplicationData     `json:"application,omitempty"`
@@ -70,6 +85,43 @@ type Response struct {
 
 	// Keys is the list of keys of any matching entities, if applicable
 	Keys []*ari.Key `json:"keys,omitempty"`
+
+	// Responses is the ordered list of responses to the requests of a Batch, if applicable
+	Responses []*Response `json:"responses,omitempty"`
+
+	// EventFilter is the event filter of the server, if applicable
+	EventFilter *EventFilter `json:"event_filter,omitempty"`
+
+	// EventReplay is the result of an event replay request, if applicable
+	EventReplay *EventReplayResult `json:"event_replay,omitempty"`
+
+	// Snapshot is the result of a node snapshot request, if applicable
+	Snapshot *NodeSnapshot `json:"snapshot,omitempty"`
+
+	// RetryAfter indicates, for a request which was rejected by rate
+	// limiting, the amount of time the client should wait before retrying.
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+
+	// Chunk, if set, indicates that this message is only a part of the
+	// response, which was too large to be sent as a single message
+	Chunk *Chunk `json:"chunk,omitempty"`
+}
+
+// Chunk is a part of a Response which was too large to be sent as a single
+// message.  The Data of the chunks of a Response, concatenated in order, are
+// its JSON encoding.
+type Chunk struct {
+	// ID identifies the Response, among any others sent to the same reply subject
+	ID string `json:"id"`
+
+	// Index is the position of the chunk, starting at 0
+	Index int `json:"index"`
+
+	// More indicates that further chunks follow
+	More bool `json:"more,omitempty"`
+
+	// Data is the part of the encoded Response
+	Data []byte `json:"data"`
 }
 
 // Err returns an error from the Response.  If the response's Error is empty, a nil error is returned.  Otherwise, the error will be filled with the value of response.Error.
@@ -77,12 +129,39 @@ func (e *Response) Err() error {
 	if e == nil {
 		return nil
 	}
+	if e.RetryAfter > 0 {
+		return &RateLimitError{RetryAfter: e.RetryAfter}
+	}
 	if e.Error != "" {
 		return errors.New(e.Error)
 	}
 	return nil
 }
 
+// IsRateLimited indicates that the returned error response was a rate limit rejection
+func (e *Response) IsRateLimited() bool {
+	return e.RetryAfter > 0
+}
+
+// RateLimitError indicates that a request was rejected because a rate limit was exceeded
+type RateLimitError struct {
+	// RetryAfter is the amount of time to wait before retrying the request
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("Rate limited; retry after %s", e.RetryAfter)
+}
+
+// NewRateLimitResponse returns a rate limit error Response with the given retry-after hint
+func NewRateLimitResponse(retryAfter time.Duration) *Response {
+	err := &RateLimitError{RetryAfter: retryAfter}
+	return &Response{
+		Error:      err.Error(),
+		RetryAfter: retryAfter,
+	}
+}
+
 // IsNotFound indicates that the retuned error response was a Not Found error response
 func (e *Response) IsNotFound() bool {
 	return e.Error == "Not found"
@@ -101,15 +180,29 @@ type Request struct {
 	// Kind indicates the type of request
 	Kind string `json:"kind"`
 
+	// Version is the ProtocolVersion of the client which issued the request
+	Version int `json:"version,omitempty"`
+
 	// Key is the key or key filter on which this request should be processed
 	Key *ari.Key `json:"key"`
 
+	// Client identifies the client which issued the request.  It is
+	// informational only and is used for auditing.
+	Client string `json:"client,omitempty"`
+
+	// IdempotencyKey uniquely identifies the logical request.  It is preserved
+	// across retries so that a server which has already executed the request
+	// may return the original response instead of executing it again.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
 	ApplicationSubscribe *ApplicationSubscribe `json:"application_subscribe,omitempty"`
 
 	AsteriskConfig         *AsteriskConfig         `json:"asterisk_config,omitempty"`
 	AsteriskLoggingChannel *AsteriskLoggingChannel `json:"asterisk_logging_channel,omitempty"`
 	AsteriskVariableSet    *AsteriskVariableSet    `json:"asterisk_variable_set,omitempty"`
 
+	Batch *Batch `json:"batch,omitempty"`
+
 	BridgeAddChannel    *BridgeAddChannel    `json:"bridge_add_channel,omitempty"`
 	BridgeCreate        *BridgeCreate        `json:"bridge_create,omitempty"`
 	BridgeMOH           *BridgeMOH           `json:"bridge_moh,omitempty"`
@@ -118,6 +211,7 @@ type Request struct {
 	BridgeRemoveChannel *BridgeRemoveChannel `json:"bridge_remove_channel,omitempty"`
 	BridgeVideoSource   *BridgeVideoSource   `json:"bridge_video_source,omitempty"`
 
+	ChannelClaim         *ChannelClaim         `json:"channel_claim,omitempty"`
 	ChannelCreate        *ChannelCreate        `json:"channel_create,omitempty"`
 	ChannelContinue      *ChannelContinue      `json:"channel_continue,omitempty"`
 	ChannelDial          *ChannelDial          `json:"channel_dial,omitempty"`
@@ -137,6 +231,9 @@ type Request struct {
 
 	EndpointListByTech *EndpointListByTech `json:"endpoint_list_by_tech,omitempty"`
 
+	EventFilter *EventFilter `json:"event_filter,omitempty"`
+	EventReplay *EventReplay `json:"event_replay,omitempty"`
+
 	MailboxUpdate *MailboxUpdate `json:"mailbox_update,omitempty"`
 
 	PlaybackControl *PlaybackControl `json:"playback_control,omitempty"`
@@ -144,6 +241,9 @@ type Request struct {
 	RecordingStoredCopy *RecordingStoredCopy `json:"recording_stored_copy,omitempty"`
 
 	SoundList *SoundList `json:"sound_list,omitempty"`
+
+	TextMessageSend      *TextMessageSend      `json:"text_message_send,omitempty"`
+	TextMessageSendByURI *TextMessageSendByURI `json:"text_message_send_by_uri,omitempty"`
 }
 
 // ApplicationSubscribe describes a request to subscribe/unsubscribe a particular ARI application to an EventSource
@@ -162,6 +262,20 @@ type AsteriskVariableSet struct {
 	Value string `json:"value"`
 }
 
+// Batch describes a request to execute an ordered list of requests on a single node in one round trip
+type Batch struct {
+	// Requests is the ordered list of requests to execute.  Batches may not be nested.
+	Requests []*Request `json:"requests"`
+
+	// ContinueOnError indicates that the remaining requests should be
+	// executed even after one of them fails.  By default, execution stops at
+	// the first failure.
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+
+	// Dialog, if set, is the dialog under which all of the requests should be executed
+	Dialog string `json:"dialog,omitempty"`
+}
+
 // BridgeAddChannel is the request type for adding a channel to a bridge
 type BridgeAddChannel struct {
 	// Channel is the channel ID to add to the bridge
@@ -337,6 +451,115 @@ type EndpointListByTech struct {
 	Tech string `json:"tech"`
 }
 
+// EventFilter describes the events which a server publishes to its canonical event subject.  Dialog event subjects are not filtered.
+type EventFilter struct {
+	// Allow is the list of event types to publish.  If it is empty, all event types which are not denied are published.
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny is the list of event types not to publish
+	Deny []string `json:"deny,omitempty"`
+
+	// AllowEntities is the list of entities whose events are published, each
+	// either an entity kind (such as "bridge") or a kind and ID (such as
+	// "bridge:conference").  If it is empty, the events of all entities which
+	// are not denied are published.
+	AllowEntities []string `json:"allow_entities,omitempty"`
+
+	// DenyEntities is the list of entities, in the form of AllowEntities, whose events are not published
+	DenyEntities []string `json:"deny_entities,omitempty"`
+
+	// Dropped is the number of events which have been withheld, by event
+	// type.  It is only set in responses.
+	Dropped map[string]int64 `json:"dropped,omitempty"`
+}
+
+// EventReplay describes a request for the recent events of a server.  Events
+// are selected either by sequence number, from FromSeq onward, or, if Entity
+// is set, by the entity which they concern, from Since onward.
+type EventReplay struct {
+	// FromSeq is the sequence number of the first event to replay
+	FromSeq uint64 `json:"from_seq,omitempty"`
+
+	// Entity is the key of the entity whose events should be replayed
+	Entity *ari.Key `json:"entity,omitempty"`
+
+	// Since is the time from which the events of the Entity should be replayed
+	Since time.Time `json:"since,omitempty"`
+
+	// Limit, if positive, is the maximum number of events to replay.  The
+	// oldest matching events are replayed first.
+	Limit int `json:"limit,omitempty"`
+
+	// Subject, if set, is the MessageBus subject to which the events should
+	// be re-published, instead of being returned in the response.  It may not
+	// be one of the subjects on which the ARI proxies publish current events.
+	Subject string `json:"subject,omitempty"`
+}
+
+// EventReplayResult describes the response to an EventReplay request
+type EventReplayResult struct {
+	// Boot identifies the run of the server whose events were replayed.  The
+	// sequence numbers of different runs are unrelated.
+	Boot string `json:"boot"`
+
+	// First and Last are the sequence numbers of the oldest and newest events
+	// held by the server
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+
+	// Complete indicates that no requested event had been discarded by the
+	// server.  It does not account for any Limit.
+	Complete bool `json:"complete"`
+
+	// Count is the number of events replayed
+	Count int `json:"count"`
+
+	// Events are the replayed events, as they were published, unless they
+	// were re-published to the requested Subject
+	Events []json.RawMessage `json:"events,omitempty"`
+}
+
+// NodeSnapshot is the data of all the entities of a node, as returned by a
+// NodeSnapshot request.  Entities which end while the snapshot is taken may
+// be omitted.
+type NodeSnapshot struct {
+	// Node is the Asterisk ID of the node, or empty if the snapshot merges
+	// those of several nodes
+	Node string `json:"node,omitempty"`
+
+	// Sequences are the positions in the event streams of the nodes, by
+	// node, at which the snapshots were taken.  The events up to them are
+	// reflected by the snapshot.
+	Sequences map[string]EventSequence `json:"sequences,omitempty"`
+
+	Channels       []*ari.ChannelData       `json:"channels,omitempty"`
+	Bridges        []*ari.BridgeData        `json:"bridges,omitempty"`
+	Playbacks      []*ari.PlaybackData      `json:"playbacks,omitempty"`
+	LiveRecordings []*ari.LiveRecordingData `json:"live_recordings,omitempty"`
+	DeviceStates   []*ari.DeviceStateData   `json:"device_states,omitempty"`
+}
+
+// Merge appends the entities of the given snapshot to those of the snapshot
+func (s *NodeSnapshot) Merge(o *NodeSnapshot) {
+	if o == nil {
+		return
+	}
+	if s.Node != o.Node {
+		s.Node = ""
+	}
+	for node, seq := range o.Sequences {
+		if s.Sequences == nil {
+			s.Sequences = make(map[string]EventSequence)
+		}
+		s.Sequences[node] = seq
+	}
+	s.Channels = append(s.Channels, o.Channels...)
+	s.Bridges = append(s.Bridges, o.Bridges...)
+	s.Playbacks = append(s.Playbacks, o.Playbacks...)
+	s.LiveRecordings = append(s.LiveRecordings, o.LiveRecordings...)
+	s.DeviceStates = append(s.DeviceStates, o.DeviceStates...)
+}
+
 // MailboxUpdate describes the request for updating a mailbox
 type MailboxUpdate struct {
 	// New is the number of New (unread) messages in the mailbox
@@ -364,6 +587,41 @@ type SoundList struct {
 	Filters map[string]string `json:"filters"`
 }
 
+// TextMessageSend describes the request for sending a text message to an
+// endpoint
+type TextMessageSend struct {
+	// From is the technology-specific URI of the sender
+	From string `json:"from"`
+
+	// Tech is the technology of the endpoint to which the message is sent
+	Tech string `json:"tech"`
+
+	// Resource is the resource of the endpoint to which the message is sent
+	Resource string `json:"resource"`
+
+	// Body is the text of the message
+	Body string `json:"body"`
+
+	// Variables are the variables to attach to the message
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// TextMessageSendByURI describes the request for sending a text message to an
+// endpoint identified by a free-form URI
+type TextMessageSendByURI struct {
+	// From is the technology-specific URI of the sender
+	From string `json:"from"`
+
+	// To is the technology-specific URI of the recipient
+	To string `json:"to"`
+
+	// Body is the text of the message
+	Body string `json:"body"`
+
+	// Variables are the variables to attach to the message
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
 // AsteriskConfig describes the request relating to asterisk configuration
 type AsteriskConfig struct {
 	// Tuples is the list of configuration tuples to update
@@ -0,0 +1,92 @@
+package proxy
+
+import "github.com/rotisserie/eris"
+
+// ProtocolVersion is the version of the protocol spoken between ARI proxy
+// clients and servers.  It is incremented whenever the meaning of existing
+// requests changes.  Requests and announcements which bear no version predate
+// versioning and are of version 0.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest version of requests which an ARI proxy
+// accepts
+const MinProtocolVersion = 0
+
+// Capabilities announced by ARI proxies which support optional features of
+// the protocol
+const (
+	// CapabilityBatch indicates support for Batch requests
+	CapabilityBatch = "batch"
+
+	// CapabilityChunking indicates that responses larger than the maximum
+	// payload of the MessageBus are sent in chunks
+	CapabilityChunking = "chunking"
+
+	// CapabilityClaims indicates that channels entering Stasis may be offered
+	// on the claim subject and claimed by ChannelClaim requests
+	CapabilityClaims = "claims"
+
+	// CapabilityDialogs indicates support for the dialog management requests
+	CapabilityDialogs = "dialogs"
+
+	// CapabilityEventFilter indicates support for EventFilter and
+	// EventFilterSet requests
+	CapabilityEventFilter = "event_filter"
+
+	// CapabilityEventReplay indicates support for EventReplay requests
+	CapabilityEventReplay = "event_replay"
+
+	// CapabilitySnapshot indicates support for NodeSnapshot requests
+	CapabilitySnapshot = "snapshot"
+
+	// CapabilityTextMessage indicates support for TextMessageSend and
+	// TextMessageSendByURI requests
+	CapabilityTextMessage = "text_message"
+)
+
+// Capabilities lists the capabilities of this version of the ARI proxy.  Each
+// ARI proxy announces those which its configuration enables.
+var Capabilities = []string{
+	CapabilityBatch,
+	CapabilityChunking,
+	CapabilityClaims,
+	CapabilityDialogs,
+	CapabilityEventFilter,
+	CapabilityEventReplay,
+	CapabilitySnapshot,
+	CapabilityTextMessage,
+}
+
+// requiredCapabilities maps the kinds of requests which not every ARI proxy
+// supports to the capability they require
+var requiredCapabilities = map[string]string{
+	"Batch":                CapabilityBatch,
+	"ChannelClaim":         CapabilityClaims,
+	"DialogBind":           CapabilityDialogs,
+	"DialogBindings":       CapabilityDialogs,
+	"DialogClose":          CapabilityDialogs,
+	"DialogList":           CapabilityDialogs,
+	"DialogUnbind":         CapabilityDialogs,
+	"EventFilter":          CapabilityEventFilter,
+	"EventFilterSet":       CapabilityEventFilter,
+	"EventReplay":          CapabilityEventReplay,
+	"NodeSnapshot":         CapabilitySnapshot,
+	"TextMessageSend":      CapabilityTextMessage,
+	"TextMessageSendByURI": CapabilityTextMessage,
+}
+
+// RequiredCapability returns the capability which an ARI proxy must announce
+// to handle requests of the given kind, or the empty string if every ARI
+// proxy handles them
+func RequiredCapability(kind string) string {
+	return requiredCapabilities[kind]
+}
+
+// CheckVersion returns an error if requests of the given protocol version are
+// not supported
+func CheckVersion(v int) error {
+	if v < MinProtocolVersion || v > ProtocolVersion {
+		return eris.Errorf("unsupported protocol version %d: this ARI proxy supports versions %d to %d", v, MinProtocolVersion, ProtocolVersion)
+	}
+	return nil
+}
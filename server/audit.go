@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// mutatingClass indicates whether requests of the given class may modify Asterisk state
+func mutatingClass(class string) bool {
+	return class == "command" || class == "create"
+}
+
+// auditReply returns the reply subject to which the request's handler should
+// respond.  If the request should be audited, the returned subject is an
+// internal one which records the outcome of the request before forwarding the
+// response on to the original reply subject.
+func (s *Server) auditReply(class string, reply string, req *proxy.Request) string {
+	if s.Audit == nil || req == nil || !mutatingClass(class) {
+		return reply
+	}
+
+	entry := &proxy.AuditEntry{
+		Timestamp:   time.Now(),
+		Node:        s.AsteriskID,
+		Application: s.Application,
+		Client:      req.Client,
+		Class:       class,
+		Kind:        req.Kind,
+		Key:         req.Key,
+	}
+	if req.Key != nil {
+		entry.Dialog = req.Key.Dialog
+	}
+	if payload, err := json.Marshal(req); err == nil {
+		entry.Payload = s.Audit.Redact(payload)
+	}
+
+	return s.interceptReply(func(resp *proxy.Response) {
+		s.publish(reply, resp)
+
+		entry.Latency = time.Since(entry.Timestamp)
+		if resp != nil {
+			entry.Error = resp.Error
+		}
+		s.audit(entry)
+	})
+}
+
+// audit records the given entry to the audit log and, if so configured, publishes it to the MessageBus
+func (s *Server) audit(entry *proxy.AuditEntry) {
+	if err := s.Audit.Write(entry); err != nil {
+		s.Log.Error("failed to write audit entry", "kind", entry.Kind, "error", err)
+	}
+
+	if s.AuditPublish {
+		subject := proxy.AuditSubject(s.MBPrefix, s.Application, s.AsteriskID)
+		if err := s.mbus.PublishAudit(subject, entry); err != nil {
+			s.Log.Warn("failed to publish MessageBus message", "subject", subject, "data", entry, "error", err)
+		}
+	}
+}
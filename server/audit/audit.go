@@ -0,0 +1,194 @@
+// Package audit provides an append-only, rotating JSONL log of the mutating
+// requests handled by an ARI proxy server.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+)
+
+// Redacted is the value which replaces any redacted field in an audit entry payload
+const Redacted = "[REDACTED]"
+
+// Config describes the configuration of an audit Logger
+type Config struct {
+	// Path is the location of the active audit log file.  Rotated files are
+	// placed alongside it, suffixed with their rotation timestamp.
+	Path string
+
+	// MaxSize is the size, in bytes, beyond which the log file will be
+	// rotated.  A zero value disables size-based rotation.
+	MaxSize int64
+
+	// MaxAge is the maximum amount of time a log file will be written to
+	// before it is rotated.  A zero value disables time-based rotation.
+	MaxAge time.Duration
+
+	// Redact is the list of payload fields whose values should be replaced
+	// before the entry is written.  Fields are described by their dotted JSON
+	// path within the request, such as
+	// "channel_originate.originate_request.variables".
+	Redact []string
+}
+
+// Logger writes audit entries to a rotating JSONL file
+type Logger struct {
+	cfg Config
+
+	f       *os.File
+	size    int64
+	created time.Time
+
+	mu sync.Mutex
+}
+
+// New opens (or creates) the audit log described by the given Config
+func New(cfg Config) (*Logger, error) {
+	if cfg.Path == "" {
+		return nil, eris.New("audit log path must be specified")
+	}
+
+	l := &Logger{
+		cfg: cfg,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Redact returns a copy of the given JSON payload with the configured fields replaced
+func (l *Logger) Redact(payload []byte) json.RawMessage {
+	if len(l.cfg.Redact) == 0 || len(payload) == 0 {
+		return payload
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return payload
+	}
+
+	for _, path := range l.cfg.Redact {
+		redact(m, strings.Split(path, "."))
+	}
+
+	out, err := json.Marshal(m)
+	if err != nil {
+		return payload
+	}
+	return out
+}
+
+func redact(m map[string]interface{}, path []string) {
+	v, ok := m[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		m[path[0]] = Redacted
+		return
+	}
+	if child, ok := v.(map[string]interface{}); ok {
+		redact(child, path[1:])
+	}
+}
+
+// Write appends the given entry to the audit log, rotating the log first if necessary
+func (l *Logger) Write(e *proxy.AuditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return eris.Wrap(err, "failed to encode audit entry")
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return eris.New("audit log is closed")
+	}
+
+	if l.needsRotation(int64(len(data))) {
+		if err = l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.f.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return eris.Wrap(err, "failed to write audit entry")
+	}
+	return nil
+}
+
+// Close closes the audit log
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+func (l *Logger) needsRotation(next int64) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.cfg.MaxSize > 0 && l.size+next > l.cfg.MaxSize {
+		return true
+	}
+	if l.cfg.MaxAge > 0 && time.Since(l.created) > l.cfg.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (l *Logger) open() error {
+	if err := os.MkdirAll(filepath.Dir(l.cfg.Path), 0o750); err != nil {
+		return eris.Wrap(err, "failed to create audit log directory")
+	}
+
+	f, err := os.OpenFile(l.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return eris.Wrap(err, "failed to open audit log")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close() // nolint: errcheck
+		return eris.Wrap(err, "failed to stat audit log")
+	}
+
+	l.f = f
+	l.size = info.Size()
+	l.created = time.Now()
+	return nil
+}
+
+// rotate moves the active log aside and opens a new one.  The caller must hold the lock.
+func (l *Logger) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return eris.Wrap(err, "failed to close audit log for rotation")
+	}
+	l.f = nil
+
+	rotated := fmt.Sprintf("%s.%s", l.cfg.Path, time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(l.cfg.Path, rotated); err != nil {
+		return eris.Wrap(err, "failed to rotate audit log")
+	}
+
+	return l.open()
+}
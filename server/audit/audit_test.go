@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func countLines(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close() // nolint: errcheck
+
+	var n int
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		n++
+	}
+	return n
+}
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := New(Config{Path: path})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	defer l.Close() // nolint: errcheck
+
+	for i := 0; i < 3; i++ {
+		if err := l.Write(&proxy.AuditEntry{Kind: "ChannelHangup"}); err != nil {
+			t.Fatalf("failed to write entry: %v", err)
+		}
+	}
+
+	if n := countLines(t, path); n != 3 {
+		t.Errorf("line count %d != 3", n)
+	}
+}
+
+func TestRotateSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+
+	l, err := New(Config{Path: path, MaxSize: 10})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	defer l.Close() // nolint: errcheck
+
+	for i := 0; i < 3; i++ {
+		if err := l.Write(&proxy.AuditEntry{Kind: "ChannelHangup"}); err != nil {
+			t.Fatalf("failed to write entry: %v", err)
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(files) != 3 {
+		t.Errorf("file count %d != 3", len(files))
+	}
+	if n := countLines(t, path); n != 1 {
+		t.Errorf("active line count %d != 1", n)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	l := &Logger{
+		cfg: Config{
+			Redact: []string{"channel_variable.value", "missing.field"},
+		},
+	}
+
+	in, _ := json.Marshal(&proxy.Request{ // nolint: errcheck
+		Kind: "ChannelVariableSet",
+		ChannelVariable: &proxy.ChannelVariable{
+			Name:  "PIN",
+			Value: "1234",
+		},
+	})
+
+	var out proxy.Request
+	if err := json.Unmarshal(l.Redact(in), &out); err != nil {
+		t.Fatalf("failed to decode redacted payload: %v", err)
+	}
+
+	if out.ChannelVariable.Value != Redacted {
+		t.Errorf("value %q was not redacted", out.ChannelVariable.Value)
+	}
+	if out.ChannelVariable.Name != "PIN" {
+		t.Errorf("name %q should not have been redacted", out.ChannelVariable.Name)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+func (s *Server) batch(ctx context.Context, reply string, req *proxy.Request) {
+	if req.Batch == nil {
+		s.sendError(reply, eris.New("Batch is mandatory"))
+		return
+	}
+
+	// The key of the response indicates the location at which the batch was executed
+	resp := &proxy.Response{
+		Key:       ari.NewKey("", "", ari.WithApp(s.Application), ari.WithNode(s.AsteriskID)),
+		Responses: make([]*proxy.Response, 0, len(req.Batch.Requests)),
+	}
+
+	for _, r := range req.Batch.Requests {
+		if r == nil {
+			r = &proxy.Request{}
+		}
+		r.Client = req.Client
+
+		if r.Key == nil {
+			r.Key = ari.NewKey("", "", ari.WithApp(s.Application), ari.WithNode(s.AsteriskID))
+		}
+		if req.Batch.Dialog != "" {
+			r.Key = ari.NewKey(r.Key.Kind, r.Key.ID, ari.WithApp(r.Key.App), ari.WithNode(r.Key.Node), ari.WithDialog(req.Batch.Dialog))
+		}
+
+		var ret *proxy.Response
+		if r.Key.Node != "" && r.Key.Node != s.AsteriskID {
+			ret = proxy.NewErrorResponse(eris.Errorf("request for node %s may not be executed by node %s", r.Key.Node, s.AsteriskID))
+		} else {
+			ret = s.execute(ctx, r)
+		}
+		resp.Responses = append(resp.Responses, ret)
+
+		if ret.Err() != nil && !req.Batch.ContinueOnError {
+			break
+		}
+	}
+
+	s.publish(reply, resp)
+}
+
+// execute runs the given request locally and returns its response
+func (s *Server) execute(ctx context.Context, req *proxy.Request) *proxy.Response {
+	if req.Kind == "Batch" {
+		return proxy.NewErrorResponse(eris.New("Batches may not be nested"))
+	}
+
+	if resp := s.rateLimit(req); resp != nil {
+		return resp
+	}
+
+	ch := make(chan *proxy.Response, 1)
+	reply := s.interceptReply(func(resp *proxy.Response) {
+		ch <- resp
+	})
+
+	// Batches are sent as create requests, so each of their operations is
+	// audited as one
+	reply = s.auditReply("create", reply, req)
+
+	var wait <-chan struct{}
+	if s.Dedupe != nil && req.IdempotencyKey != "" {
+		if wait = s.Dedupe.Begin(req.IdempotencyKey); wait == nil {
+			reply = s.dedupeReply(reply, req.IdempotencyKey)
+		}
+	}
+
+	if wait != nil {
+		s.replyDuplicate(ctx, reply, req.IdempotencyKey, wait)
+	} else {
+		s.dispatchRequest(ctx, reply, req)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp == nil {
+			resp = &proxy.Response{}
+		}
+		return resp
+	default:
+		// Complete the request, so that its audit and idempotency records
+		// reflect the failure
+		s.publish(reply, proxy.NewErrorResponse(eris.New("no response")))
+		return <-ch
+	}
+}
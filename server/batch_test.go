@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/audit"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+func newBatchTestServer() (*Server, *arimocks.Channel) {
+	ch := &arimocks.Channel{}
+
+	cl := &arimocks.Client{}
+	cl.On("Channel").Return(ch)
+
+	s := New()
+	s.ari = cl
+	s.Application = "asdf"
+	s.AsteriskID = "1"
+
+	return s, ch
+}
+
+func runBatch(s *Server, b *proxy.Batch) *proxy.Response {
+	var resp *proxy.Response
+	s.batch(context.Background(), s.interceptReply(func(r *proxy.Response) {
+		resp = r
+	}), &proxy.Request{
+		Kind:  "Batch",
+		Batch: b,
+	})
+	return resp
+}
+
+func TestBatch(t *testing.T) {
+	s, ch := newBatchTestServer()
+
+	k1 := ari.NewKey(ari.ChannelKey, "c1")
+	k2 := ari.NewKey(ari.ChannelKey, "c2")
+
+	ch.On("Answer", k1).Return(nil)
+	ch.On("Answer", k2).Return(nil)
+
+	resp := runBatch(s, &proxy.Batch{
+		Requests: []*proxy.Request{
+			{Kind: "ChannelAnswer", Key: k1},
+			{Kind: "ChannelAnswer", Key: k2},
+		},
+	})
+
+	if len(resp.Responses) != 2 {
+		t.Fatalf("response count %d != 2", len(resp.Responses))
+	}
+	for i, r := range resp.Responses {
+		if r.Err() != nil {
+			t.Errorf("unexpected error for operation %d: %v", i, r.Err())
+		}
+	}
+	if resp.Key == nil || resp.Key.Node != "1" {
+		t.Errorf("batch response should indicate the executing node: %v", resp.Key)
+	}
+}
+
+func TestBatchStopOnError(t *testing.T) {
+	s, ch := newBatchTestServer()
+
+	k1 := ari.NewKey(ari.ChannelKey, "c1")
+	k2 := ari.NewKey(ari.ChannelKey, "c2")
+
+	ch.On("Answer", k1).Return(errors.New("boom"))
+	ch.On("Answer", k2).Return(nil)
+
+	resp := runBatch(s, &proxy.Batch{
+		Requests: []*proxy.Request{
+			{Kind: "ChannelAnswer", Key: k1},
+			{Kind: "ChannelAnswer", Key: k2},
+		},
+	})
+
+	if len(resp.Responses) != 1 {
+		t.Fatalf("response count %d != 1", len(resp.Responses))
+	}
+	if resp.Responses[0].Error != "boom" {
+		t.Errorf("unexpected error %q", resp.Responses[0].Error)
+	}
+	ch.AssertNotCalled(t, "Answer", k2)
+}
+
+func TestBatchContinueOnError(t *testing.T) {
+	s, ch := newBatchTestServer()
+
+	ch.On("Answer", ari.NewKey(ari.ChannelKey, "c1", ari.WithDialog("d1"))).Return(errors.New("boom"))
+	ch.On("Answer", ari.NewKey(ari.ChannelKey, "c2", ari.WithDialog("d1"))).Return(nil)
+
+	resp := runBatch(s, &proxy.Batch{
+		ContinueOnError: true,
+		Dialog:          "d1",
+		Requests: []*proxy.Request{
+			{Kind: "ChannelAnswer", Key: ari.NewKey(ari.ChannelKey, "c1")},
+			{Kind: "ChannelAnswer", Key: ari.NewKey(ari.ChannelKey, "c2")},
+			{Kind: "Batch"},
+		},
+	})
+
+	if len(resp.Responses) != 3 {
+		t.Fatalf("response count %d != 3", len(resp.Responses))
+	}
+	if resp.Responses[1].Err() != nil {
+		t.Errorf("unexpected error for operation 1: %v", resp.Responses[1].Err())
+	}
+	if resp.Responses[2].Err() == nil {
+		t.Error("nested batch should have failed")
+	}
+	if d := s.Dialog.List("channel", "c2"); len(d) != 1 || d[0] != "d1" {
+		t.Errorf("channel should have been bound to the batch dialog: %v", d)
+	}
+}
+
+func TestBatchAudit(t *testing.T) {
+	s, ch := newBatchTestServer()
+
+	var err error
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if s.Audit, err = audit.New(audit.Config{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Audit.Close() // nolint: errcheck
+
+	k1 := ari.NewKey(ari.ChannelKey, "c1")
+	k2 := ari.NewKey(ari.ChannelKey, "c2")
+
+	ch.On("Hangup", k1, "normal").Return(nil).Once()
+	ch.On("Hangup", k2, "normal").Return(errors.New("not found"))
+
+	b := &proxy.Batch{
+		ContinueOnError: true,
+		Requests: []*proxy.Request{
+			{Kind: "ChannelHangup", Key: k1, ChannelHangup: &proxy.ChannelHangup{Reason: "normal"}, IdempotencyKey: "op1"},
+			{Kind: "ChannelHangup", Key: k2, ChannelHangup: &proxy.ChannelHangup{Reason: "normal"}},
+		},
+	}
+	runBatch(s, b)
+
+	// A repeated operation is answered from the idempotency cache
+	resp := runBatch(s, &proxy.Batch{Requests: b.Requests[:1]})
+	if len(resp.Responses) != 1 || resp.Responses[0].Err() != nil {
+		t.Fatalf("unexpected response to repeated operation: %+v", resp.Responses)
+	}
+	ch.AssertNumberOfCalls(t, "Hangup", 2)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []proxy.AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e proxy.AuditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("audit entry count %d != 3", len(entries))
+	}
+	if entries[0].Kind != "ChannelHangup" || entries[0].Key.ID != "c1" || entries[0].Error != "" {
+		t.Errorf("unexpected audit entry for first operation: %+v", entries[0])
+	}
+	if entries[1].Key.ID != "c2" || entries[1].Error == "" {
+		t.Errorf("expected audit entry of failed operation to record its error: %+v", entries[1])
+	}
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/fallback"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultClaimAttempts is the default number of times a channel is offered
+// to be claimed before the fallback is applied
+var DefaultClaimAttempts = 3
+
+// UnlistenedDelay is the amount of time for which a channel which enters
+// Stasis while no listener is present is held before the fallback is applied
+// to it, so that channels created through the proxy may be recognized
+var UnlistenedDelay = time.Second
+
+// createdChannelTTL is the amount of time for which channels created through
+// the proxy are remembered, absent their destruction
+var createdChannelTTL = time.Hour
+
+// channelCreateKinds are the request Kinds which create channels
+var channelCreateKinds = map[string]bool{
+	"ChannelCreate":        true,
+	"ChannelExternalMedia": true,
+	"ChannelOriginate":     true,
+	"ChannelSnoop":         true,
+}
+
+// claimTracker follows the channels which have been offered to be claimed
+type claimTracker struct {
+	// pending are the outstanding offers, by channel ID
+	pending map[string]*claimOffer
+
+	// created are the channels which were created through the proxy, by
+	// channel ID.  They belong to the clients which created them, so the
+	// fallback is not applied to them.
+	created map[string]time.Time
+
+	// pruned is the time at which created was last pruned
+	pruned time.Time
+
+	// listenerSeen is the time at which the presence of a listener was last announced
+	listenerSeen time.Time
+
+	mu sync.Mutex
+}
+
+type claimOffer struct {
+	event   *ari.StasisStart
+	token   string
+	attempt int
+	timer   *time.Timer
+}
+
+func newClaimTracker() *claimTracker {
+	return &claimTracker{
+		pending: make(map[string]*claimOffer),
+		created: make(map[string]time.Time),
+	}
+}
+
+// handleClaims offers channels which enter Stasis to be claimed and forgets
+// those which leave it
+func (s *Server) handleClaims(ctx context.Context, e ari.Event) {
+	if s.ClaimTimeout <= 0 && s.ListenerTTL <= 0 {
+		return
+	}
+
+	switch v := e.(type) {
+	case *ari.StasisStart:
+		if s.ClaimTimeout > 0 {
+			s.offerChannel(ctx, v, 1)
+		} else if !s.listenersPresent() {
+			s.holdChannel(ctx, v)
+		}
+	case *ari.StasisEnd:
+		s.forgetClaim(v.Channel.ID)
+	case *ari.ChannelDestroyed:
+		s.forgetClaim(v.Channel.ID)
+	}
+}
+
+// offerChannel publishes the StasisStart event of a channel to the claim
+// subject, to be claimed by a single listener within the ClaimTimeout
+func (s *Server) offerChannel(ctx context.Context, e *ari.StasisStart, attempt int) {
+	id := e.Channel.ID
+	o := &claimOffer{
+		event:   e,
+		token:   rid.New("cl"),
+		attempt: attempt,
+	}
+
+	s.claims.mu.Lock()
+	if old, ok := s.claims.pending[id]; ok {
+		old.timer.Stop()
+	}
+	s.claims.pending[id] = o
+	o.timer = time.AfterFunc(s.ClaimTimeout, func() {
+		s.claimExpired(ctx, id, o.token)
+	})
+	s.claims.mu.Unlock()
+
+	s.publishEvent(proxy.ClaimSubject(s.MBPrefix, s.Application, s.AsteriskID), &proxy.StasisOffer{
+		StasisStart: e,
+		Claim: proxy.Claim{
+			Token:   o.token,
+			Attempt: attempt,
+		},
+	})
+}
+
+// holdChannel tracks a channel which entered Stasis while no listener was
+// present, so that the fallback may be applied to it
+func (s *Server) holdChannel(ctx context.Context, e *ari.StasisStart) {
+	id := e.Channel.ID
+	o := &claimOffer{
+		event:   e,
+		token:   rid.New("cl"),
+		attempt: 1,
+	}
+
+	s.claims.mu.Lock()
+	defer s.claims.mu.Unlock()
+
+	if old, ok := s.claims.pending[id]; ok {
+		old.timer.Stop()
+	}
+	s.claims.pending[id] = o
+	o.timer = time.AfterFunc(UnlistenedDelay, func() {
+		s.claimExpired(ctx, id, o.token)
+	})
+}
+
+// listenerAnnounced records the presence of a listener
+func (s *Server) listenerAnnounced() {
+	s.claims.mu.Lock()
+	s.claims.listenerSeen = time.Now()
+	s.claims.mu.Unlock()
+}
+
+// listenersPresent indicates whether any listener has announced its presence
+// within the ListenerTTL.  Listeners are always assumed to be present if
+// their presence is not tracked.
+func (s *Server) listenersPresent() bool {
+	if s.ListenerTTL <= 0 {
+		return true
+	}
+
+	s.claims.mu.Lock()
+	defer s.claims.mu.Unlock()
+
+	return time.Since(s.claims.listenerSeen) <= s.ListenerTTL
+}
+
+// claimExpired offers the channel again or, once the offer has been made
+// ClaimAttempts times or if no listener is present, applies the
+// ClaimFallback to it
+func (s *Server) claimExpired(ctx context.Context, id, token string) {
+	s.claims.mu.Lock()
+	o, ok := s.claims.pending[id]
+	if !ok || o.token != token {
+		s.claims.mu.Unlock()
+		return
+	}
+
+	_, created := s.claims.created[id]
+	if created || len(s.Dialog.List("channel", id)) > 0 {
+		// The channel is already controlled by a client
+		delete(s.claims.pending, id)
+		s.claims.mu.Unlock()
+		return
+	}
+
+	attempts := s.ClaimAttempts
+	if attempts < 1 {
+		attempts = DefaultClaimAttempts
+	}
+	present := s.ListenerTTL <= 0 || time.Since(s.claims.listenerSeen) <= s.ListenerTTL
+	if s.ClaimTimeout > 0 && present && o.attempt < attempts {
+		s.claims.mu.Unlock()
+		s.Log.Debug("channel was not claimed; offering again", "channel", id, "attempt", o.attempt)
+		s.offerChannel(ctx, o.event, o.attempt+1)
+		return
+	}
+
+	delete(s.claims.pending, id)
+	s.claims.mu.Unlock()
+
+	s.Log.Warn("channel was not claimed; applying fallback", "channel", id, "attempts", o.attempt, "listeners", present, "action", s.ClaimFallback.Action)
+	if err := fallback.Run(ctx, s.ari, o.event.Key(ari.ChannelKey, id), s.ClaimFallback); err != nil {
+		s.Log.Error("failed to apply fallback to unclaimed channel", "channel", id, "error", err)
+	}
+}
+
+// forgetClaim stops tracking the channel
+func (s *Server) forgetClaim(id string) {
+	s.claims.mu.Lock()
+	defer s.claims.mu.Unlock()
+
+	if o, ok := s.claims.pending[id]; ok {
+		o.timer.Stop()
+		delete(s.claims.pending, id)
+	}
+	delete(s.claims.created, id)
+}
+
+// claimTouched stops tracking the channel concerned by the request, if any,
+// since a client which operates on a channel controls it, whether or not it
+// claimed it.  A client may, for instance, have taken the channel from its
+// StasisStart event through an older ARI proxy client.
+func (s *Server) claimTouched(req *proxy.Request) {
+	if s.ClaimTimeout <= 0 && s.ListenerTTL <= 0 {
+		return
+	}
+	if req.Kind == "ChannelClaim" || req.Key == nil || req.Key.Kind != ari.ChannelKey || req.Key.ID == "" {
+		return
+	}
+
+	s.claims.mu.Lock()
+	defer s.claims.mu.Unlock()
+
+	if o, ok := s.claims.pending[req.Key.ID]; ok {
+		o.timer.Stop()
+		delete(s.claims.pending, req.Key.ID)
+	}
+}
+
+// claimCreateReply returns a reply subject which records the channel created
+// by the given request, if any, before forwarding the response to the
+// original reply subject.
+func (s *Server) claimCreateReply(reply string, req *proxy.Request) string {
+	if (s.ClaimTimeout <= 0 && s.ListenerTTL <= 0) || !channelCreateKinds[req.Kind] {
+		return reply
+	}
+
+	return s.interceptReply(func(resp *proxy.Response) {
+		if resp.Err() == nil && resp.Key != nil && resp.Key.ID != "" {
+			now := time.Now()
+
+			s.claims.mu.Lock()
+			s.claims.created[resp.Key.ID] = now
+			if now.Sub(s.claims.pruned) > createdChannelTTL/10 {
+				for id, t := range s.claims.created {
+					if now.Sub(t) > createdChannelTTL {
+						delete(s.claims.created, id)
+					}
+				}
+				s.claims.pruned = now
+			}
+			s.claims.mu.Unlock()
+		}
+
+		s.publish(reply, resp)
+	})
+}
+
+func (s *Server) channelClaim(ctx context.Context, reply string, req *proxy.Request) {
+	var token string
+	if req.ChannelClaim != nil {
+		token = req.ChannelClaim.Token
+	}
+
+	s.claims.mu.Lock()
+	o, ok := s.claims.pending[req.Key.ID]
+	switch {
+	case !ok:
+		s.claims.mu.Unlock()
+		s.sendError(reply, eris.New("channel is not awaiting a claim"))
+		return
+	case o.token != token:
+		s.claims.mu.Unlock()
+		s.sendError(reply, eris.New("claim offer has expired"))
+		return
+	}
+	o.timer.Stop()
+	delete(s.claims.pending, req.Key.ID)
+	s.claims.mu.Unlock()
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+	}
+
+	s.publish(reply, &proxy.Response{})
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/fallback"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+func stasisStart(id string) *ari.StasisStart {
+	return &ari.StasisStart{
+		EventData: ari.EventData{Type: "StasisStart", Application: "asdf", Node: "1"},
+		Channel:   ari.ChannelData{ID: id},
+	}
+}
+
+func claimRequest(s *Server, id, token string) *proxy.Response {
+	var resp *proxy.Response
+	s.dispatchRequest(context.Background(), s.interceptReply(func(r *proxy.Response) {
+		resp = r
+	}), &proxy.Request{
+		Kind:         "ChannelClaim",
+		Key:          ari.NewKey(ari.ChannelKey, id, ari.WithDialog("d1")),
+		ChannelClaim: &proxy.ChannelClaim{Token: token},
+	})
+	return resp
+}
+
+func TestChannelClaim(t *testing.T) {
+	s, _ := newBatchTestServer()
+	rec := &eventRecorder{}
+	s.mbus = rec
+	s.ClaimTimeout = time.Minute
+
+	s.handleClaims(context.Background(), stasisStart("c1"))
+	if n := rec.count(proxy.ClaimSubject("ari.", "asdf", "1")); n != 1 {
+		t.Fatalf("channel was offered %d times", n)
+	}
+
+	token := s.claims.pending["c1"].token
+
+	if resp := claimRequest(s, "c1", "other"); resp.Err() == nil {
+		t.Error("claim with the wrong token should fail")
+	}
+	if resp := claimRequest(s, "c1", token); resp.Err() != nil {
+		t.Errorf("claim failed: %v", resp.Err())
+	}
+	if resp := claimRequest(s, "c1", token); resp.Err() == nil {
+		t.Error("second claim should fail")
+	}
+
+	if d := s.Dialog.List("channel", "c1"); len(d) != 1 || d[0] != "d1" {
+		t.Errorf("claimed channel was not bound to the claimant's dialog: %v", d)
+	}
+}
+
+func TestChannelClaimFallback(t *testing.T) {
+	s, ch := newBatchTestServer()
+	rec := &eventRecorder{}
+	s.mbus = rec
+	s.ClaimTimeout = 10 * time.Millisecond
+	s.ClaimAttempts = 2
+	s.ClaimFallback = fallback.Policy{Action: fallback.ActionHangup, Cause: "congestion"}
+
+	done := make(chan struct{})
+	key := ari.NewKey(ari.ChannelKey, "c1", ari.WithApp("asdf"), ari.WithNode("1"))
+	ch.On("Hangup", key, "congestion").Return(nil).Run(func(mock.Arguments) {
+		close(done)
+	})
+
+	s.handleClaims(context.Background(), stasisStart("c1"))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("fallback was not applied")
+	}
+	if n := rec.count(proxy.ClaimSubject("ari.", "asdf", "1")); n != 2 {
+		t.Errorf("channel was offered %d times", n)
+	}
+}
+
+func TestChannelClaimCreatedExempt(t *testing.T) {
+	s, _ := newBatchTestServer()
+	s.mbus = &eventRecorder{}
+	s.ClaimTimeout = 10 * time.Millisecond
+
+	s.publish(s.claimCreateReply(s.interceptReply(func(*proxy.Response) {}), &proxy.Request{Kind: "ChannelOriginate"}), &proxy.Response{
+		Key: ari.NewKey(ari.ChannelKey, "c1"),
+	})
+
+	s.handleClaims(context.Background(), stasisStart("c1"))
+	time.Sleep(50 * time.Millisecond)
+
+	s.claims.mu.Lock()
+	defer s.claims.mu.Unlock()
+	if _, ok := s.claims.pending["c1"]; ok {
+		t.Error("channel created through the proxy should not be offered again")
+	}
+}
+
+func TestUnlistenedFallback(t *testing.T) {
+	defer func(d time.Duration) { UnlistenedDelay = d }(UnlistenedDelay)
+	UnlistenedDelay = 10 * time.Millisecond
+
+	s, ch := newBatchTestServer()
+	s.mbus = &eventRecorder{}
+	s.ListenerTTL = time.Minute
+	s.ClaimFallback = fallback.Policy{Action: fallback.ActionContinue, Context: "closed", Extension: "s", Priority: 1}
+
+	done := make(chan struct{})
+	key := ari.NewKey(ari.ChannelKey, "c2", ari.WithApp("asdf"), ari.WithNode("1"))
+	ch.On("Continue", key, "closed", "s", 1).Return(nil).Run(func(mock.Arguments) {
+		close(done)
+	})
+
+	// A listener is present
+	s.listenerAnnounced()
+	s.handleClaims(context.Background(), stasisStart("c1"))
+
+	// No listener is present
+	s.claims.mu.Lock()
+	s.claims.listenerSeen = time.Now().Add(-time.Hour)
+	s.claims.mu.Unlock()
+	s.handleClaims(context.Background(), stasisStart("c2"))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("fallback was not applied")
+	}
+	ch.AssertNumberOfCalls(t, "Continue", 1)
+}
+
+func TestChannelClaimTouchedExempt(t *testing.T) {
+	s, ch := newBatchTestServer()
+	rec := &eventRecorder{}
+	s.mbus = rec
+	s.ClaimTimeout = 10 * time.Millisecond
+	s.ClaimFallback = fallback.Policy{Action: fallback.ActionHangup, Cause: "congestion"}
+
+	ch.On("Answer", mock.Anything).Return(nil)
+
+	s.handleClaims(context.Background(), stasisStart("c1"))
+
+	// The channel is answered by a client which did not claim it
+	s.dispatchRequest(context.Background(), s.interceptReply(func(*proxy.Response) {}), &proxy.Request{
+		Kind: "ChannelAnswer",
+		Key:  ari.NewKey(ari.ChannelKey, "c1"),
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	ch.AssertNotCalled(t, "Hangup", mock.Anything, mock.Anything)
+	if n := rec.count(proxy.ClaimSubject("ari.", "asdf", "1")); n != 1 {
+		t.Errorf("channel was offered %d times", n)
+	}
+}
+
+func TestUnlistenedCreatedExempt(t *testing.T) {
+	defer func(d time.Duration) { UnlistenedDelay = d }(UnlistenedDelay)
+	UnlistenedDelay = 10 * time.Millisecond
+
+	s, ch := newBatchTestServer()
+	s.mbus = &eventRecorder{}
+	s.ListenerTTL = time.Minute
+	s.ClaimFallback = fallback.Policy{Action: fallback.ActionHangup, Cause: "congestion"}
+
+	s.publish(s.claimCreateReply(s.interceptReply(func(*proxy.Response) {}), &proxy.Request{Kind: "ChannelOriginate"}), &proxy.Response{
+		Key: ari.NewKey(ari.ChannelKey, "c1"),
+	})
+
+	// No listener is present
+	s.handleClaims(context.Background(), stasisStart("c1"))
+	time.Sleep(50 * time.Millisecond)
+
+	ch.AssertNotCalled(t, "Hangup", mock.Anything, mock.Anything)
+}
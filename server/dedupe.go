@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+)
+
+// dedupeReply returns an internal reply subject which stores the response to
+// the request with the given idempotency key before forwarding it on to the
+// original reply subject.
+func (s *Server) dedupeReply(reply string, key string) string {
+	return s.interceptReply(func(resp *proxy.Response) {
+		s.Dedupe.Complete(key, resp)
+		s.publish(reply, resp)
+	})
+}
+
+// replyDuplicate waits for the original request with the given idempotency
+// key to complete and replies with its response.
+func (s *Server) replyDuplicate(ctx context.Context, reply string, key string, wait <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-wait:
+	}
+
+	resp := s.Dedupe.Response(key)
+	if resp == nil {
+		s.sendError(reply, eris.New("outcome of duplicate request is unknown"))
+		return
+	}
+	s.publish(reply, resp)
+}
@@ -0,0 +1,168 @@
+// Package dedupe provides a bounded, expiring cache of request responses,
+// keyed by request idempotency key, by which an ARI proxy server avoids
+// executing retried requests more than once.
+package dedupe
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// DefaultTTL is the default amount of time for which a response is retained
+var DefaultTTL = time.Minute
+
+// DefaultSize is the default maximum number of responses retained
+var DefaultSize = 10000
+
+// Cache is a bounded, expiring cache of responses keyed by idempotency key
+type Cache struct {
+	ttl  time.Duration
+	size int
+
+	entries map[string]*list.Element
+
+	// order lists the entries from oldest to newest
+	order *list.List
+
+	hits int64
+
+	now func() time.Time
+
+	mu sync.Mutex
+}
+
+type entry struct {
+	key     string
+	created time.Time
+	resp    *proxy.Response
+
+	// done is closed when the response is available
+	done chan struct{}
+}
+
+// New returns a new Cache which retains responses for the given TTL, up to
+// the given number of entries.  Non-positive values select the defaults.
+func New(ttl time.Duration, size int) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	return &Cache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Begin registers the start of execution of the request with the given key.
+//
+// If no request with the key has been seen, Begin returns a nil channel, and
+// the caller is responsible for executing the request and calling Complete.
+//
+// Otherwise, Begin returns a channel which is closed once the original
+// request completes, after which Response returns its response.
+func (c *Cache) Begin(key string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.expire(now)
+
+	if el, ok := c.entries[key]; ok {
+		c.hits++
+		return el.Value.(*entry).done
+	}
+
+	c.entries[key] = c.order.PushBack(&entry{
+		key:     key,
+		created: now,
+		done:    make(chan struct{}),
+	})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Front())
+	}
+
+	return nil
+}
+
+// Complete stores the response for the request with the given key and releases any duplicates waiting on it
+func (c *Cache) Complete(key string, resp *proxy.Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return
+	}
+
+	e := el.Value.(*entry)
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+	e.resp = resp
+	close(e.done)
+}
+
+// Response returns the stored response for the given key.  It returns nil if
+// the request has not completed or the response is no longer retained.
+func (c *Cache) Response(key string) *proxy.Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	return el.Value.(*entry).resp
+}
+
+// Hits returns the number of duplicate requests which have been detected
+func (c *Cache) Hits() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hits
+}
+
+// Len returns the number of entries currently retained
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// expire removes entries older than the TTL.  The caller must hold the lock.
+func (c *Cache) expire(now time.Time) {
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		if now.Sub(el.Value.(*entry).created) < c.ttl {
+			return
+		}
+		c.remove(el)
+	}
+}
+
+// remove removes the given entry, releasing any waiters.  The caller must hold the lock.
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+
+	select {
+	case <-e.done:
+	default:
+		close(e.done)
+	}
+
+	delete(c.entries, e.key)
+	c.order.Remove(el)
+}
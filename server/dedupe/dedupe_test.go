@@ -0,0 +1,85 @@
+package dedupe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestDuplicate(t *testing.T) {
+	c := New(time.Minute, 10)
+
+	if ch := c.Begin("a"); ch != nil {
+		t.Fatal("first request should not be a duplicate")
+	}
+
+	ch := c.Begin("a")
+	if ch == nil {
+		t.Fatal("second request should be a duplicate")
+	}
+
+	select {
+	case <-ch:
+		t.Fatal("duplicate should wait for the original to complete")
+	default:
+	}
+
+	c.Complete("a", &proxy.Response{Error: "boom"})
+
+	select {
+	case <-ch:
+	default:
+		t.Fatal("duplicate should be released on completion")
+	}
+
+	if resp := c.Response("a"); resp == nil || resp.Error != "boom" {
+		t.Errorf("unexpected cached response: %v", resp)
+	}
+
+	if c.Hits() != 1 {
+		t.Errorf("hit count %d != 1", c.Hits())
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	c := New(time.Minute, 10)
+	c.now = func() time.Time { return now }
+
+	c.Begin("a")
+	c.Complete("a", &proxy.Response{})
+
+	now = now.Add(2 * time.Minute)
+
+	if ch := c.Begin("a"); ch != nil {
+		t.Error("expired request should not be a duplicate")
+	}
+}
+
+func TestBounded(t *testing.T) {
+	c := New(time.Minute, 2)
+
+	pending := c.Begin("a")
+	if pending != nil {
+		t.Fatal("first request should not be a duplicate")
+	}
+	waiter := c.Begin("a")
+
+	c.Begin("b")
+	c.Begin("c")
+
+	if c.Len() != 2 {
+		t.Errorf("length %d != 2", c.Len())
+	}
+
+	select {
+	case <-waiter:
+	default:
+		t.Error("waiters on evicted entries should be released")
+	}
+	if c.Response("a") != nil {
+		t.Error("evicted entry should have no response")
+	}
+}
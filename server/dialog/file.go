@@ -0,0 +1,273 @@
+package dialog
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rotisserie/eris"
+)
+
+// DefaultCompactThreshold is the default number of log records after which the
+// file manager writes a new snapshot and truncates its log
+var DefaultCompactThreshold = 10000
+
+const (
+	snapshotFile = "dialogs.snapshot"
+	logFile      = "dialogs.log"
+
+	opBind         = "bind"
+	opUnbind       = "unbind"
+	opUnbindDialog = "unbind_dialog"
+	opDetach       = "detach"
+)
+
+// record is a single entry of the write-ahead log
+type record struct {
+	Op     string `json:"op"`
+	Dialog string `json:"dialog,omitempty"`
+	Type   string `json:"type,omitempty"`
+	ID     string `json:"id,omitempty"`
+}
+
+// FileManager is a dialog manager which persists its bindings to a directory
+// on disk, as a snapshot plus a write-ahead log of changes since that
+// snapshot, so that bindings survive restarts of the proxy.
+type FileManager struct {
+	mem *memManager
+
+	dir string
+
+	// CompactThreshold is the number of log records after which a new
+	// snapshot is written and the log truncated
+	CompactThreshold int
+
+	log     *os.File
+	records int
+
+	// err is the first error encountered while writing to disk
+	err error
+
+	mu sync.Mutex
+}
+
+// NewFileManager returns a new dialog manager which persists its bindings in
+// the given directory.  Any bindings previously stored there are loaded
+// before it returns.
+func NewFileManager(dir string) (*FileManager, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, eris.Wrap(err, "failed to create dialog directory")
+	}
+
+	m := &FileManager{
+		mem:              NewMemManager().(*memManager),
+		dir:              dir,
+		CompactThreshold: DefaultCompactThreshold,
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	// Start from a clean snapshot and an empty log
+	if err := m.compact(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// load reads the snapshot and replays the log
+func (m *FileManager) load() error {
+	data, err := os.ReadFile(filepath.Join(m.dir, snapshotFile))
+	if err != nil && !os.IsNotExist(err) {
+		return eris.Wrap(err, "failed to read dialog snapshot")
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &m.mem.bindings); err != nil {
+			return eris.Wrap(err, "failed to decode dialog snapshot")
+		}
+	}
+
+	f, err := os.Open(filepath.Join(m.dir, logFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return eris.Wrap(err, "failed to open dialog log")
+	}
+	defer f.Close() // nolint: errcheck
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A partially-written record can only be the last one, left by
+			// an unclean shutdown; discard it and anything after it.
+			break
+		}
+		m.apply(&r)
+	}
+	return eris.Wrap(scanner.Err(), "failed to read dialog log")
+}
+
+func (m *FileManager) apply(r *record) {
+	switch r.Op {
+	case opBind:
+		m.mem.Bind(r.Dialog, r.Type, r.ID)
+	case opUnbind:
+		m.mem.Unbind(r.Type, r.ID)
+	case opUnbindDialog:
+		m.mem.UnbindDialog(r.Dialog)
+	case opDetach:
+		m.mem.Detach(r.Dialog, r.Type, r.ID)
+	}
+}
+
+// compact writes a snapshot of the current bindings and truncates the log.  The caller must hold the lock, if the manager is in use.
+func (m *FileManager) compact() error {
+	m.mem.mu.RLock()
+	bindings := make(map[string][]string, len(m.mem.bindings))
+	for k, v := range m.mem.bindings {
+		if len(v) > 0 {
+			bindings[k] = v
+		}
+	}
+	data, err := json.Marshal(bindings)
+	m.mem.mu.RUnlock()
+	if err != nil {
+		return eris.Wrap(err, "failed to encode dialog snapshot")
+	}
+
+	tmp := filepath.Join(m.dir, snapshotFile+".tmp")
+	if err = writeFileSync(tmp, data); err != nil {
+		return eris.Wrap(err, "failed to write dialog snapshot")
+	}
+	if err = os.Rename(tmp, filepath.Join(m.dir, snapshotFile)); err != nil {
+		return eris.Wrap(err, "failed to replace dialog snapshot")
+	}
+
+	if m.log != nil {
+		m.log.Close() // nolint: errcheck
+	}
+	m.log, err = os.OpenFile(filepath.Join(m.dir, logFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		m.log = nil
+		return eris.Wrap(err, "failed to open dialog log")
+	}
+	m.records = 0
+
+	return nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+	return f.Close()
+}
+
+// write applies the given record and appends it to the log
+func (m *FileManager) write(r *record) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apply(r)
+
+	if m.log == nil {
+		return
+	}
+
+	data, err := json.Marshal(r)
+	if err == nil {
+		_, err = m.log.Write(append(data, '\n'))
+	}
+	if err != nil {
+		m.fail(eris.Wrap(err, "failed to write dialog log"))
+		return
+	}
+
+	m.records++
+	if m.CompactThreshold > 0 && m.records >= m.CompactThreshold {
+		m.fail(m.compact())
+	}
+}
+
+// fail records the first write error.  The caller must hold the lock.
+func (m *FileManager) fail(err error) {
+	if err != nil && m.err == nil {
+		m.err = err
+	}
+}
+
+// Err returns the first error encountered while persisting bindings, if any
+func (m *FileManager) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.err
+}
+
+// List implements Manager
+func (m *FileManager) List(eType, id string) []string {
+	return m.mem.List(eType, id)
+}
+
+// Bind implements Manager
+func (m *FileManager) Bind(dialog, eType, id string) {
+	if dialog == "" || eType == "" || id == "" {
+		return
+	}
+	m.write(&record{Op: opBind, Dialog: dialog, Type: eType, ID: id})
+}
+
+// Unbind implements Manager
+func (m *FileManager) Unbind(eType, id string) {
+	m.write(&record{Op: opUnbind, Type: eType, ID: id})
+}
+
+// UnbindDialog implements Manager
+func (m *FileManager) UnbindDialog(dialog string) {
+	m.write(&record{Op: opUnbindDialog, Dialog: dialog})
+}
+
+// Detach implements Manager
+func (m *FileManager) Detach(dialog, eType, id string) {
+	m.write(&record{Op: opDetach, Dialog: dialog, Type: eType, ID: id})
+}
+
+// Bindings implements Manager
+func (m *FileManager) Bindings() []Binding {
+	return m.mem.Bindings()
+}
+
+// Close writes a final snapshot and closes the log
+func (m *FileManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.log == nil {
+		return m.err
+	}
+
+	err := m.compact()
+	if m.log != nil {
+		m.log.Close() // nolint: errcheck
+		m.log = nil
+	}
+	if err != nil {
+		return err
+	}
+	return m.err
+}
@@ -0,0 +1,99 @@
+package dialog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileRestore(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFileManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Bind("testDialog", "testType", "testID")
+	m.Bind("testDialog2", "testType", "testID")
+	m.Bind("testDialog", "testType", "testID2")
+	m.Unbind("testType", "testID2")
+	m.UnbindDialog("testDialog2")
+
+	// Simulate an unclean shutdown by abandoning m without closing it
+	m2, err := NewFileManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close() // nolint: errcheck
+
+	if list := m2.List("testType", "testID"); len(list) != 1 || list[0] != "testDialog" {
+		t.Errorf("List('testType','testID') => %v != [testDialog]", list)
+	}
+	if list := m2.List("testType", "testID2"); len(list) != 0 {
+		t.Errorf("List('testType','testID2') => %v != []", list)
+	}
+}
+
+func TestFileCompact(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFileManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.CompactThreshold = 2
+
+	m.Bind("testDialog", "testType", "testID")
+	m.Bind("testDialog", "testType", "testID2")
+	m.Bind("testDialog", "testType", "testID3")
+
+	if m.records != 1 {
+		t.Errorf("log records %d != 1", m.records)
+	}
+
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := NewFileManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close() // nolint: errcheck
+
+	for _, id := range []string{"testID", "testID2", "testID3"} {
+		if len(m2.List("testType", id)) != 1 {
+			t.Errorf("binding for %s was not restored", id)
+		}
+	}
+}
+
+func TestFileTruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFileManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Bind("testDialog", "testType", "testID")
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString(`{"op":"bind","dialog":"partial`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close() // nolint: errcheck
+
+	m2, err := NewFileManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close() // nolint: errcheck
+
+	if len(m2.List("testType", "testID")) != 1 {
+		t.Error("binding before the partial record was not restored")
+	}
+}
@@ -0,0 +1,148 @@
+package dialog
+
+import (
+	"sync"
+	"time"
+)
+
+// GCStats describes the state of the bindings of a Manager and the activity of its GC
+type GCStats struct {
+	// Entities is the number of entities bound to at least one dialog
+	Entities int
+
+	// Dialogs is the number of distinct dialogs with at least one binding
+	Dialogs int
+
+	// Bindings is the total number of dialog-entity bindings
+	Bindings int
+
+	// Released is the number of entities whose bindings were removed because the entity ended
+	Released int64
+
+	// Swept is the number of entities whose bindings were removed because the entity was found to no longer exist
+	Swept int64
+
+	// Expired is the number of entities whose bindings were removed because they exceeded the maximum age
+	Expired int64
+}
+
+// GC removes the bindings of entities which no longer exist
+type GC struct {
+	m Manager
+
+	maxAge time.Duration
+
+	// shared indicates that the bindings of the Manager are shared with other
+	// proxies, so that entities missing from the lists of live entities may
+	// belong to other nodes
+	shared bool
+
+	// seen records the time at which each bound entity was first observed by the GC
+	seen map[string]time.Time
+
+	stats GCStats
+
+	now func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewGC returns a GC for the given Manager.  If maxAge is positive, bindings
+// which have been observed for longer than maxAge are removed by Sweep, even
+// if their entities cannot otherwise be shown to have ended.
+func NewGC(m Manager, maxAge time.Duration) *GC {
+	return &GC{
+		m:      m,
+		maxAge: maxAge,
+		shared: IsShared(m),
+		seen:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Release removes the bindings of an entity which has ended
+func (g *GC) Release(eType, id string) {
+	if len(g.m.List(eType, id)) == 0 {
+		return
+	}
+	g.m.Unbind(eType, id)
+
+	g.mu.Lock()
+	delete(g.seen, bindingHash(eType, id))
+	g.stats.Released++
+	g.mu.Unlock()
+}
+
+// Sweep removes the bindings of entities which no longer exist.
+//
+// live holds, by entity type, the set of entities which existed as of
+// listedAt.  Bound entities of those types which are not listed are removed,
+// unless they were first observed after listedAt.  Bindings for entities of
+// other types are removed only once they exceed the maximum age.
+//
+// If the bindings are shared with other proxies, the live entities are
+// ignored, since bound entities may exist on other nodes, and bindings are
+// removed only once they exceed the maximum age.
+func (g *GC) Sweep(live map[string]map[string]bool, listedAt time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	current := make(map[string]bool)
+
+	for _, b := range g.m.Bindings() {
+		h := bindingHash(b.Type, b.ID)
+
+		first, ok := g.seen[h]
+		if !ok {
+			first = now
+			g.seen[h] = now
+		}
+
+		if ids, ok := live[b.Type]; ok && !g.shared && !ids[b.ID] && first.Before(listedAt) {
+			g.m.Unbind(b.Type, b.ID)
+			g.stats.Swept++
+			continue
+		}
+
+		if g.maxAge > 0 && now.Sub(first) > g.maxAge {
+			g.m.Unbind(b.Type, b.ID)
+			g.stats.Expired++
+			continue
+		}
+
+		current[h] = true
+	}
+
+	for h := range g.seen {
+		if !current[h] {
+			delete(g.seen, h)
+		}
+	}
+}
+
+// Shared indicates that the bindings are shared with other proxies, so that
+// Sweep disregards the live entities
+func (g *GC) Shared() bool {
+	return g.shared
+}
+
+// Stats returns the current binding counts and GC activity
+func (g *GC) Stats() GCStats {
+	dialogs := make(map[string]bool)
+
+	g.mu.Lock()
+	ret := g.stats
+	g.mu.Unlock()
+
+	for _, b := range g.m.Bindings() {
+		ret.Entities++
+		ret.Bindings += len(b.Dialogs)
+		for _, d := range b.Dialogs {
+			dialogs[d] = true
+		}
+	}
+	ret.Dialogs = len(dialogs)
+
+	return ret
+}
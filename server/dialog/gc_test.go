@@ -0,0 +1,122 @@
+package dialog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGCRelease(t *testing.T) {
+	m := NewMemManager()
+	g := NewGC(m, 0)
+
+	m.Bind("testDialog", "channel", "testID")
+	m.Bind("testDialog2", "channel", "testID")
+
+	g.Release("channel", "testID")
+	g.Release("channel", "unbound")
+
+	if len(m.List("channel", "testID")) != 0 {
+		t.Error("bindings of released entity remain")
+	}
+	if s := g.Stats(); s.Released != 1 || s.Entities != 0 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestGCSweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	m := NewMemManager()
+	g := NewGC(m, time.Hour)
+	g.now = func() time.Time { return now }
+
+	m.Bind("testDialog", "channel", "gone")
+	m.Bind("testDialog", "channel", "live")
+	m.Bind("testDialog", "playback", "testPlayback")
+
+	live := map[string]map[string]bool{
+		"channel": {"live": true},
+	}
+
+	// Bindings first observed after the list was taken are never swept
+	g.Sweep(live, now.Add(-time.Second))
+	if len(m.List("channel", "gone")) != 1 {
+		t.Fatal("newly-observed binding was swept")
+	}
+
+	now = now.Add(time.Minute)
+	g.Sweep(live, now)
+
+	if len(m.List("channel", "gone")) != 0 {
+		t.Error("binding of missing channel was not swept")
+	}
+	if len(m.List("channel", "live")) != 1 {
+		t.Error("binding of live channel was swept")
+	}
+	if len(m.List("playback", "testPlayback")) != 1 {
+		t.Error("binding of unchecked type was swept before its maximum age")
+	}
+
+	now = now.Add(time.Hour)
+	g.Sweep(live, now)
+
+	if len(m.List("playback", "testPlayback")) != 0 {
+		t.Error("binding exceeding maximum age was not expired")
+	}
+
+	s := g.Stats()
+	if s.Swept != 1 || s.Expired != 2 || s.Entities != 0 || s.Dialogs != 0 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestGCSweepShared(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Unix(1000, 0)
+
+	m, err := NewKVManager(ctx, NewMemKV(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGC(m, time.Hour)
+	g.now = func() time.Time { return now }
+
+	// The channel of another node is never listed by this one
+	m.Bind("testDialog", "channel", "remote")
+
+	live := map[string]map[string]bool{
+		"channel": {},
+	}
+
+	g.Sweep(live, now)
+	now = now.Add(time.Minute)
+	g.Sweep(live, now)
+
+	if len(m.List("channel", "remote")) != 1 {
+		t.Fatal("binding in shared store was swept for missing from the local list")
+	}
+
+	now = now.Add(time.Hour)
+	g.Sweep(live, now)
+
+	if len(m.List("channel", "remote")) != 0 {
+		t.Error("binding in shared store exceeding maximum age was not expired")
+	}
+}
+
+func TestGCStats(t *testing.T) {
+	m := NewMemManager()
+	g := NewGC(m, 0)
+
+	m.Bind("testDialog", "channel", "a")
+	m.Bind("testDialog2", "channel", "a")
+	m.Bind("testDialog", "bridge", "b")
+
+	s := g.Stats()
+	if s.Entities != 2 || s.Dialogs != 2 || s.Bindings != 3 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
@@ -0,0 +1,276 @@
+package dialog
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+	"github.com/rotisserie/eris"
+)
+
+// KVEntry is a change to a key of a KV store
+type KVEntry struct {
+	Key     string
+	Value   []byte
+	Deleted bool
+}
+
+// KV is a minimal key-value store by which dialog bindings may be shared among several proxies
+type KV interface {
+	// Put stores the value for the given key
+	Put(key string, value []byte) error
+
+	// Delete removes the given key
+	Delete(key string) error
+
+	// Watch returns a channel of changes to the store.  The current contents
+	// of the store are sent first, followed by a nil entry, after which
+	// subsequent changes are sent until the context is closed.
+	Watch(ctx context.Context) (<-chan *KVEntry, error)
+}
+
+// kvManager is a dialog manager which stores its bindings in a (possibly shared) KV store.
+//
+// Each binding is stored as its own key, so that concurrent changes by
+// several proxies never conflict.  Lookups are served from a local cache,
+// which is kept current by watching the store.
+type kvManager struct {
+	kv KV
+
+	cache *memManager
+
+	log log15.Logger
+}
+
+// NewKVManager returns a new dialog manager which stores its bindings in the
+// given KV store.  It returns once the current bindings have been loaded, and
+// it keeps its view of the store current until the context is closed.  Failures
+// to write to the store are logged to the given logger, if any.
+func NewKVManager(ctx context.Context, kv KV, log log15.Logger) (Manager, error) {
+	updates, err := kv.Watch(ctx)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to watch dialog store")
+	}
+
+	if log == nil {
+		log = log15.New()
+		log.SetHandler(log15.DiscardHandler())
+	}
+
+	m := &kvManager{
+		kv:    kv,
+		cache: NewMemManager().(*memManager),
+		log:   log,
+	}
+
+	// Load the initial bindings
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case e, ok := <-updates:
+			if !ok {
+				return nil, eris.New("dialog store watch closed")
+			}
+			if e == nil {
+				go m.watch(ctx, updates)
+				return m, nil
+			}
+			m.update(e)
+		}
+	}
+}
+
+func (m *kvManager) watch(ctx context.Context, updates <-chan *KVEntry) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-updates:
+			if !ok {
+				return
+			}
+			if e != nil {
+				m.update(e)
+			}
+		}
+	}
+}
+
+func (m *kvManager) update(e *KVEntry) {
+	dialog, eType, id, ok := parseBindingKey(e.Key)
+	if !ok {
+		return
+	}
+
+	if e.Deleted {
+		m.cache.Detach(dialog, eType, id)
+		return
+	}
+	m.cache.Bind(dialog, eType, id)
+}
+
+func (m *kvManager) List(eType, id string) []string {
+	return m.cache.List(eType, id)
+}
+
+func (m *kvManager) Bind(dialog, eType, id string) {
+	if dialog == "" || eType == "" || id == "" {
+		return
+	}
+
+	m.cache.Bind(dialog, eType, id)
+	if err := m.kv.Put(bindingKey(dialog, eType, id), nil); err != nil {
+		m.log.Error("failed to store dialog binding", "dialog", dialog, "kind", eType, "id", id, "error", err)
+	}
+}
+
+func (m *kvManager) Unbind(eType, id string) {
+	for _, d := range m.cache.List(eType, id) {
+		m.delete(d, eType, id)
+	}
+	m.cache.Unbind(eType, id)
+}
+
+func (m *kvManager) UnbindDialog(dialog string) {
+	m.cache.mu.RLock()
+	var keys []string
+	for k, list := range m.cache.bindings {
+		for _, d := range list {
+			if d == dialog {
+				keys = append(keys, k)
+			}
+		}
+	}
+	m.cache.mu.RUnlock()
+
+	for _, k := range keys {
+		eType, id, _ := strings.Cut(k, ":")
+		m.delete(dialog, eType, id)
+	}
+	m.cache.UnbindDialog(dialog)
+}
+
+func (m *kvManager) Detach(dialog, eType, id string) {
+	m.delete(dialog, eType, id)
+	m.cache.Detach(dialog, eType, id)
+}
+
+// delete removes a binding from the store, logging any failure
+func (m *kvManager) delete(dialog, eType, id string) {
+	if err := m.kv.Delete(bindingKey(dialog, eType, id)); err != nil {
+		m.log.Error("failed to delete dialog binding", "dialog", dialog, "kind", eType, "id", id, "error", err)
+	}
+}
+
+// Shared indicates that the bindings are shared with other proxies
+func (m *kvManager) Shared() bool {
+	return true
+}
+
+func (m *kvManager) Bindings() []Binding {
+	return m.cache.Bindings()
+}
+
+var keyEncoding = base64.RawURLEncoding
+
+// bindingKey returns the KV key for a binding.  The components are encoded so
+// that the key is valid for restrictive stores such as NATS KV.
+func bindingKey(dialog, eType, id string) string {
+	return keyEncoding.EncodeToString([]byte(eType)) + "." +
+		keyEncoding.EncodeToString([]byte(id)) + "." +
+		keyEncoding.EncodeToString([]byte(dialog))
+}
+
+func parseBindingKey(key string) (dialog, eType, id string, ok bool) {
+	pieces := strings.Split(key, ".")
+	if len(pieces) != 3 {
+		return "", "", "", false
+	}
+
+	decoded := make([]string, 3)
+	for i, p := range pieces {
+		b, err := keyEncoding.DecodeString(p)
+		if err != nil {
+			return "", "", "", false
+		}
+		decoded[i] = string(b)
+	}
+	return decoded[2], decoded[0], decoded[1], true
+}
+
+// MemKV is an in-memory KV store, primarily useful for testing
+type MemKV struct {
+	data map[string][]byte
+
+	watchers []chan *KVEntry
+
+	mu sync.Mutex
+}
+
+// NewMemKV returns a new in-memory KV store
+func NewMemKV() *MemKV {
+	return &MemKV{
+		data: make(map[string][]byte),
+	}
+}
+
+// Put implements KV
+func (kv *MemKV) Put(key string, value []byte) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.data[key] = value
+	kv.notify(&KVEntry{Key: key, Value: value})
+	return nil
+}
+
+// Delete implements KV
+func (kv *MemKV) Delete(key string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	delete(kv.data, key)
+	kv.notify(&KVEntry{Key: key, Deleted: true})
+	return nil
+}
+
+// notify sends the entry to all watchers.  The caller must hold the lock.
+func (kv *MemKV) notify(e *KVEntry) {
+	for _, w := range kv.watchers {
+		w <- e
+	}
+}
+
+// Watch implements KV
+func (kv *MemKV) Watch(ctx context.Context) (<-chan *KVEntry, error) {
+	kv.mu.Lock()
+
+	// Leave room for subsequent changes beyond the current contents
+	w := make(chan *KVEntry, len(kv.data)+1000)
+	for k, v := range kv.data {
+		w <- &KVEntry{Key: k, Value: v}
+	}
+	w <- nil
+	kv.watchers = append(kv.watchers, w)
+	kv.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		kv.mu.Lock()
+		defer kv.mu.Unlock()
+
+		for i, c := range kv.watchers {
+			if c == w {
+				kv.watchers = append(kv.watchers[:i], kv.watchers[i+1:]...)
+				close(w)
+				return
+			}
+		}
+	}()
+
+	return w, nil
+}
@@ -0,0 +1,128 @@
+package dialog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+func eventually(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Errorf("timed out waiting for %s", desc)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKVBindingKey(t *testing.T) {
+	key := bindingKey("dialog.1", "channel", "1500000000.12")
+
+	dialog, eType, id, ok := parseBindingKey(key)
+	if !ok || dialog != "dialog.1" || eType != "channel" || id != "1500000000.12" {
+		t.Errorf("failed to parse key %s: %s %s %s", key, dialog, eType, id)
+	}
+}
+
+func TestKVShared(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kv := NewMemKV()
+
+	a, err := NewKVManager(ctx, kv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKVManager(ctx, kv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Bind("testDialog", "testType", "testID")
+	a.Bind("testDialog2", "testType", "testID")
+
+	eventually(t, "binding to propagate", func() bool {
+		return len(b.List("testType", "testID")) == 2
+	})
+
+	b.UnbindDialog("testDialog2")
+
+	eventually(t, "dialog unbinding to propagate", func() bool {
+		list := a.List("testType", "testID")
+		return len(list) == 1 && list[0] == "testDialog"
+	})
+
+	b.Unbind("testType", "testID")
+
+	eventually(t, "entity unbinding to propagate", func() bool {
+		return len(a.List("testType", "testID")) == 0
+	})
+}
+
+func TestKVLoad(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kv := NewMemKV()
+
+	a, err := NewKVManager(ctx, kv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Bind("testDialog", "testType", "testID")
+
+	// A manager started later sees existing bindings immediately
+	b, err := NewKVManager(ctx, kv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.List("testType", "testID")) != 1 {
+		t.Error("existing binding was not loaded")
+	}
+}
+
+// failingKV is a KV store whose writes fail
+type failingKV struct {
+	*MemKV
+}
+
+func (failingKV) Put(key string, value []byte) error { return errors.New("store unavailable") }
+func (failingKV) Delete(key string) error            { return errors.New("store unavailable") }
+
+func TestKVWriteErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var logged []string
+	log := log15.New()
+	log.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		mu.Lock()
+		logged = append(logged, r.Msg)
+		mu.Unlock()
+		return nil
+	}))
+
+	m, err := NewKVManager(ctx, failingKV{NewMemKV()}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Bind("d1", "channel", "c1")
+	m.Unbind("channel", "c1")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logged) != 2 || logged[0] != "failed to store dialog binding" || logged[1] != "failed to delete dialog binding" {
+		t.Errorf("expected store failures to be logged, got %v", logged)
+	}
+}
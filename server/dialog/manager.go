@@ -1,6 +1,9 @@
 package dialog
 
-import "sync"
+import (
+	"strings"
+	"sync"
+)
 
 // Manager is a dialog manager, which tracks associations between dialogs and entities
 type Manager interface {
@@ -15,6 +18,31 @@ type Manager interface {
 
 	// UnbindDialog removes all bindings for the given dialog
 	UnbindDialog(dialog string)
+
+	// Detach removes the binding of the given dialog to an entity type-ID pair, leaving any other dialogs bound to it
+	Detach(dialog, eType, id string)
+
+	// Bindings returns all entities which are bound to at least one dialog
+	Bindings() []Binding
+}
+
+// Binding describes the dialogs to which an entity is bound
+type Binding struct {
+	// Type is the entity type
+	Type string
+
+	// ID is the entity ID
+	ID string
+
+	// Dialogs is the list of dialogs to which the entity is bound
+	Dialogs []string
+}
+
+// IsShared indicates whether the bindings of the given Manager are shared with
+// other proxies, which may bind entities of other Asterisk nodes
+func IsShared(m Manager) bool {
+	s, ok := m.(interface{ Shared() bool })
+	return ok && s.Shared()
 }
 
 func bindingHash(eType, id string) string {
@@ -96,3 +124,41 @@ func (m *memManager) UnbindDialog(dialog string) {
 	}
 	m.mu.Unlock()
 }
+
+func (m *memManager) Detach(dialog, eType, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h := bindingHash(eType, id)
+	list := m.bindings[h]
+
+	ret := make([]string, 0, len(list))
+	for _, d := range list {
+		if d != dialog {
+			ret = append(ret, d)
+		}
+	}
+	if len(ret) == 0 {
+		delete(m.bindings, h)
+		return
+	}
+	m.bindings[h] = ret
+}
+
+func (m *memManager) Bindings() (ret []Binding) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for k, list := range m.bindings {
+		if len(list) == 0 {
+			continue
+		}
+		eType, id, _ := strings.Cut(k, ":")
+		ret = append(ret, Binding{
+			Type:    eType,
+			ID:      id,
+			Dialogs: append([]string(nil), list...),
+		})
+	}
+	return ret
+}
@@ -0,0 +1,96 @@
+package dialog
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultBucket is the default name of the NATS KV bucket in which dialog bindings are stored
+var DefaultBucket = "ari-proxy-dialogs"
+
+// NatsKV is a KV store backed by a NATS JetStream KV bucket
+type NatsKV struct {
+	kv nats.KeyValue
+}
+
+// NewNatsKV returns a KV store backed by the given NATS JetStream KV bucket,
+// which is created if it does not already exist
+func NewNatsKV(nc *nats.Conn, bucket string) (*NatsKV, error) {
+	if bucket == "" {
+		bucket = DefaultBucket
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to get JetStream context")
+	}
+
+	kv, err := js.KeyValue(bucket)
+	if eris.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "ARI proxy dialog bindings",
+			History:     1,
+		})
+	}
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to open dialog bucket %s", bucket)
+	}
+
+	return &NatsKV{kv: kv}, nil
+}
+
+// Put implements KV
+func (n *NatsKV) Put(key string, value []byte) error {
+	_, err := n.kv.Put(key, value)
+	return err
+}
+
+// Delete implements KV
+func (n *NatsKV) Delete(key string) error {
+	return n.kv.Delete(key)
+}
+
+// Watch implements KV
+func (n *NatsKV) Watch(ctx context.Context) (<-chan *KVEntry, error) {
+	w, err := n.kv.WatchAll(nats.Context(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *KVEntry, 256)
+	go func() {
+		defer close(ch)
+		defer w.Stop() // nolint: errcheck
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-w.Updates():
+				if !ok {
+					return
+				}
+
+				var entry *KVEntry
+				if e != nil {
+					entry = &KVEntry{
+						Key:     e.Key(),
+						Value:   e.Value(),
+						Deleted: e.Operation() != nats.KeyValuePut,
+					}
+				}
+
+				select {
+				case ch <- entry:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
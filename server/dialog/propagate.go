@@ -0,0 +1,251 @@
+package dialog
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// Propagation rules, by which the dialogs of one entity are automatically bound to related entities
+const (
+	// PropagateBridge binds a bridge to the dialogs of each channel which
+	// enters it, until the channel leaves the bridge.
+	PropagateBridge = "bridge"
+
+	// PropagateBridgeMembers binds each channel which enters a bridge to the
+	// dialogs of that bridge, until the channel leaves the bridge.
+	PropagateBridgeMembers = "bridge_members"
+
+	// PropagateDial binds a dialed channel to the dialogs of its caller.
+	PropagateDial = "dial"
+
+	// PropagatePlayback binds a playback to the dialogs of the channel or
+	// bridge on which it is played.
+	PropagatePlayback = "playback"
+
+	// PropagateRecording binds a live recording to the dialogs of the channel
+	// or bridge which it records.
+	PropagateRecording = "recording"
+
+	// PropagateVariable binds the channel whose ID is set in one of the
+	// configured channel variables to the dialogs of the channel on which the
+	// variable is set.
+	PropagateVariable = "variable"
+)
+
+// DefaultPropagationDepth is the default maximum length of a chain of propagated bindings
+var DefaultPropagationDepth = 3
+
+// PropagationConfig describes the set of propagation rules to apply
+type PropagationConfig struct {
+	// Rules is the list of propagation rules to apply
+	Rules []string `mapstructure:"rules"`
+
+	// Variables is the list of channel variables whose values are channel IDs, for the PropagateVariable rule
+	Variables []string `mapstructure:"variables"`
+
+	// MaxDepth is the maximum length of a chain of propagated bindings,
+	// starting from an explicit binding.  It defaults to
+	// DefaultPropagationDepth.
+	MaxDepth int `mapstructure:"max_depth"`
+}
+
+// link identifies the binding of a dialog to an entity
+type link struct {
+	dialog string
+	entity string
+}
+
+// Propagator binds entities to the dialogs of related entities, as they
+// become related, and removes those bindings once the relationship ends.
+//
+// Bindings which were made explicitly are never removed by the Propagator, and
+// chains of propagated bindings are limited in length, so that relationships
+// which loop back upon themselves terminate.
+type Propagator struct {
+	m Manager
+
+	rules     map[string]bool
+	variables map[string]bool
+	maxDepth  int
+
+	// sources lists, for each propagated binding, the entities from which it was propagated
+	sources map[link]map[string]bool
+
+	// depth is the length of the chain of each propagated binding
+	depth map[link]int
+
+	mu sync.Mutex
+}
+
+// NewPropagator returns a Propagator which applies the given rules to the bindings of the given Manager
+func NewPropagator(m Manager, cfg PropagationConfig) *Propagator {
+	p := &Propagator{
+		m:         m,
+		rules:     make(map[string]bool),
+		variables: make(map[string]bool),
+		maxDepth:  cfg.MaxDepth,
+		sources:   make(map[link]map[string]bool),
+		depth:     make(map[link]int),
+	}
+	if p.maxDepth < 1 {
+		p.maxDepth = DefaultPropagationDepth
+	}
+	for _, r := range cfg.Rules {
+		p.rules[strings.ToLower(r)] = true
+	}
+	for _, v := range cfg.Variables {
+		p.variables[v] = true
+	}
+	return p
+}
+
+// Handle applies the propagation rules to the given event.  It should be
+// called before the event is published to its dialogs, so that the event
+// reaches any newly-bound dialogs.
+func (p *Propagator) Handle(e ari.Event) {
+	switch v := e.(type) {
+	case *ari.ChannelEnteredBridge:
+		if p.rules[PropagateBridge] {
+			p.propagate(ari.ChannelKey, v.Channel.ID, ari.BridgeKey, v.Bridge.ID)
+		}
+		if p.rules[PropagateBridgeMembers] {
+			p.propagate(ari.BridgeKey, v.Bridge.ID, ari.ChannelKey, v.Channel.ID)
+		}
+	case *ari.ChannelLeftBridge:
+		p.release(ari.ChannelKey, v.Channel.ID, ari.BridgeKey, v.Bridge.ID)
+		p.release(ari.BridgeKey, v.Bridge.ID, ari.ChannelKey, v.Channel.ID)
+	case *ari.Dial:
+		if p.rules[PropagateDial] && v.Caller.ID != "" && v.Peer.ID != "" {
+			p.propagate(ari.ChannelKey, v.Caller.ID, ari.ChannelKey, v.Peer.ID)
+		}
+	case *ari.PlaybackStarted:
+		if p.rules[PropagatePlayback] {
+			if sType, sID, ok := parseTarget(v.Playback.TargetURI); ok {
+				p.propagate(sType, sID, ari.PlaybackKey, v.Playback.ID)
+			}
+		}
+	case *ari.RecordingStarted:
+		if p.rules[PropagateRecording] {
+			if sType, sID, ok := parseTarget(v.Recording.TargetURI); ok {
+				p.propagate(sType, sID, ari.LiveRecordingKey, v.Recording.Name)
+			}
+		}
+	case *ari.ChannelVarset:
+		if p.rules[PropagateVariable] && v.Channel.ID != "" && v.Value != "" && p.variables[v.Variable] {
+			p.propagate(ari.ChannelKey, v.Channel.ID, ari.ChannelKey, v.Value)
+		}
+	case *ari.ChannelDestroyed:
+		p.forget(ari.ChannelKey, v.Channel.ID)
+	case *ari.BridgeDestroyed:
+		p.forget(ari.BridgeKey, v.Bridge.ID)
+	case *ari.PlaybackFinished:
+		p.forget(ari.PlaybackKey, v.Playback.ID)
+	case *ari.RecordingFinished:
+		p.forget(ari.LiveRecordingKey, v.Recording.Name)
+	case *ari.RecordingFailed:
+		p.forget(ari.LiveRecordingKey, v.Recording.Name)
+	}
+}
+
+// parseTarget parses a playback or recording target URI, such as "channel:1234"
+func parseTarget(uri string) (eType, id string, ok bool) {
+	eType, id, ok = strings.Cut(uri, ":")
+	if !ok || id == "" || (eType != ari.ChannelKey && eType != ari.BridgeKey) {
+		return "", "", false
+	}
+	return eType, id, true
+}
+
+// propagate binds the target entity to each dialog of the source entity
+func (p *Propagator) propagate(sType, sID, tType, tID string) {
+	if sType == tType && sID == tID {
+		return
+	}
+	source := bindingHash(sType, sID)
+	target := bindingHash(tType, tID)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, d := range p.m.List(sType, sID) {
+		// Explicit bindings have a depth of zero
+		depth := p.depth[link{d, source}] + 1
+		if depth > p.maxDepth {
+			continue
+		}
+
+		l := link{d, target}
+		if _, ok := p.sources[l]; !ok {
+			if bound(p.m.List(tType, tID), d) {
+				// Explicitly bound; leave it alone
+				continue
+			}
+			p.sources[l] = make(map[string]bool)
+			p.depth[l] = depth
+			p.m.Bind(d, tType, tID)
+		}
+		p.sources[l][source] = true
+		if depth < p.depth[l] {
+			p.depth[l] = depth
+		}
+	}
+}
+
+// release removes the bindings which were propagated from the source entity to the target entity
+func (p *Propagator) release(sType, sID, tType, tID string) {
+	source := bindingHash(sType, sID)
+	target := bindingHash(tType, tID)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for l, sources := range p.sources {
+		if l.entity != target || !sources[source] {
+			continue
+		}
+		delete(sources, source)
+		if len(sources) == 0 {
+			delete(p.sources, l)
+			delete(p.depth, l)
+			p.m.Detach(l.dialog, tType, tID)
+		}
+	}
+}
+
+// forget discards all propagation state of an entity which has ended,
+// releasing any bindings which were propagated from it
+func (p *Propagator) forget(eType, id string) {
+	entity := bindingHash(eType, id)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for l, sources := range p.sources {
+		if l.entity == entity {
+			delete(p.sources, l)
+			delete(p.depth, l)
+			continue
+		}
+		if !sources[entity] {
+			continue
+		}
+		delete(sources, entity)
+		if len(sources) == 0 {
+			delete(p.sources, l)
+			delete(p.depth, l)
+			tType, tID, _ := strings.Cut(l.entity, ":")
+			p.m.Detach(l.dialog, tType, tID)
+		}
+	}
+}
+
+func bound(list []string, dialog string) bool {
+	for _, d := range list {
+		if d == dialog {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package dialog
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestPropagateBridge(t *testing.T) {
+	m := NewMemManager()
+	p := NewPropagator(m, PropagationConfig{Rules: []string{PropagateBridge}})
+
+	m.Bind("testDialog", "channel", "a")
+	m.Bind("testDialog", "channel", "b")
+
+	p.Handle(&ari.ChannelEnteredBridge{Channel: ari.ChannelData{ID: "a"}, Bridge: ari.BridgeData{ID: "br"}})
+	p.Handle(&ari.ChannelEnteredBridge{Channel: ari.ChannelData{ID: "b"}, Bridge: ari.BridgeData{ID: "br"}})
+
+	if list := m.List("bridge", "br"); len(list) != 1 || list[0] != "testDialog" {
+		t.Fatalf("bridge was not bound to the channel dialog: %v", list)
+	}
+
+	// The binding remains while any channel of the dialog is in the bridge
+	p.Handle(&ari.ChannelLeftBridge{Channel: ari.ChannelData{ID: "a"}, Bridge: ari.BridgeData{ID: "br"}})
+	if len(m.List("bridge", "br")) != 1 {
+		t.Error("bridge was unbound while a dialog channel remains")
+	}
+
+	p.Handle(&ari.ChannelLeftBridge{Channel: ari.ChannelData{ID: "b"}, Bridge: ari.BridgeData{ID: "br"}})
+	if len(m.List("bridge", "br")) != 0 {
+		t.Error("bridge was not unbound when the relationship ended")
+	}
+}
+
+func TestPropagateKeepsExplicit(t *testing.T) {
+	m := NewMemManager()
+	p := NewPropagator(m, PropagationConfig{Rules: []string{PropagateBridge}})
+
+	m.Bind("testDialog", "channel", "a")
+	m.Bind("testDialog", "bridge", "br")
+
+	p.Handle(&ari.ChannelEnteredBridge{Channel: ari.ChannelData{ID: "a"}, Bridge: ari.BridgeData{ID: "br"}})
+	p.Handle(&ari.ChannelLeftBridge{Channel: ari.ChannelData{ID: "a"}, Bridge: ari.BridgeData{ID: "br"}})
+
+	if len(m.List("bridge", "br")) != 1 {
+		t.Error("explicit binding was removed")
+	}
+}
+
+func TestPropagateDepth(t *testing.T) {
+	m := NewMemManager()
+	p := NewPropagator(m, PropagationConfig{
+		Rules:    []string{PropagateDial},
+		MaxDepth: 2,
+	})
+
+	m.Bind("testDialog", "channel", "a")
+
+	p.Handle(&ari.Dial{Caller: ari.ChannelData{ID: "a"}, Peer: ari.ChannelData{ID: "b"}})
+	p.Handle(&ari.Dial{Caller: ari.ChannelData{ID: "b"}, Peer: ari.ChannelData{ID: "c"}})
+	p.Handle(&ari.Dial{Caller: ari.ChannelData{ID: "c"}, Peer: ari.ChannelData{ID: "d"}})
+
+	// A loop back to the origin changes nothing
+	p.Handle(&ari.Dial{Caller: ari.ChannelData{ID: "c"}, Peer: ari.ChannelData{ID: "a"}})
+
+	if len(m.List("channel", "c")) != 1 {
+		t.Error("binding within the maximum depth was not propagated")
+	}
+	if len(m.List("channel", "d")) != 0 {
+		t.Error("binding beyond the maximum depth was propagated")
+	}
+
+	// Ending an entity releases the bindings propagated from it
+	p.Handle(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "b"}})
+	if len(m.List("channel", "c")) != 0 {
+		t.Error("binding propagated from an ended entity remains")
+	}
+	if len(m.List("channel", "a")) != 1 {
+		t.Error("explicit binding was removed")
+	}
+}
+
+func TestPropagatePlayback(t *testing.T) {
+	m := NewMemManager()
+	p := NewPropagator(m, PropagationConfig{Rules: []string{PropagatePlayback, PropagateVariable}, Variables: []string{"PEER"}})
+
+	m.Bind("testDialog", "bridge", "br")
+	m.Bind("testDialog", "channel", "a")
+
+	p.Handle(&ari.PlaybackStarted{Playback: ari.PlaybackData{ID: "pb", TargetURI: "bridge:br"}})
+	if len(m.List("playback", "pb")) != 1 {
+		t.Error("playback was not bound to the bridge dialog")
+	}
+
+	p.Handle(&ari.ChannelVarset{Channel: ari.ChannelData{ID: "a"}, Variable: "OTHER", Value: "x"})
+	p.Handle(&ari.ChannelVarset{Channel: ari.ChannelData{ID: "a"}, Variable: "PEER", Value: "b"})
+	if len(m.List("channel", "x")) != 0 {
+		t.Error("channel named by an unconfigured variable was bound")
+	}
+	if len(m.List("channel", "b")) != 1 {
+		t.Error("channel named by a configured variable was not bound")
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// DefaultDialogSweepInterval is the default interval at which dialog bindings are checked against the entities which exist in Asterisk
+var DefaultDialogSweepInterval = 5 * time.Minute
+
+// DefaultDialogMaxAge is the default age after which any dialog binding is removed
+var DefaultDialogMaxAge = 24 * time.Hour
+
+// releaseBindings removes the dialog bindings of any entity which has ended with the given event
+func (s *Server) releaseBindings(e ari.Event) {
+	if s.dialogGC == nil {
+		return
+	}
+
+	switch v := e.(type) {
+	case *ari.ChannelDestroyed:
+		s.dialogGC.Release(ari.ChannelKey, v.Channel.ID)
+	case *ari.BridgeDestroyed:
+		s.dialogGC.Release(ari.BridgeKey, v.Bridge.ID)
+	case *ari.PlaybackFinished:
+		s.dialogGC.Release(ari.PlaybackKey, v.Playback.ID)
+	case *ari.RecordingFinished:
+		s.releaseRecording(v.Recording.Name)
+	case *ari.RecordingFailed:
+		s.releaseRecording(v.Recording.Name)
+	}
+}
+
+// releaseRecording removes the bindings of a live recording, which are made
+// under "recording" by request handlers but are keyed as "liverecording" by
+// events.
+func (s *Server) releaseRecording(name string) {
+	s.dialogGC.Release("recording", name)
+	s.dialogGC.Release(ari.LiveRecordingKey, name)
+}
+
+// runDialogCleaner periodically removes the dialog bindings of channels and
+// bridges which no longer exist, as well as any bindings which have exceeded
+// the maximum age
+func (s *Server) runDialogCleaner(ctx context.Context) {
+	if s.dialogGC == nil || s.DialogSweepInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.DialogSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepDialogs()
+		}
+	}
+}
+
+func (s *Server) sweepDialogs() {
+	listedAt := time.Now()
+	live := make(map[string]map[string]bool)
+
+	// The entities bound in a shared store may belong to other nodes, so
+	// they are removed only when they end or expire
+	if s.dialogGC.Shared() {
+		s.dialogGC.Sweep(nil, listedAt)
+		s.logDialogStats()
+		return
+	}
+
+	if list, err := s.ari.Channel().List(nil); err != nil {
+		s.Log.Warn("failed to list channels for dialog sweep", "error", err)
+	} else {
+		live[ari.ChannelKey] = keyIDs(list)
+	}
+
+	if list, err := s.ari.Bridge().List(nil); err != nil {
+		s.Log.Warn("failed to list bridges for dialog sweep", "error", err)
+	} else {
+		live[ari.BridgeKey] = keyIDs(list)
+	}
+
+	s.dialogGC.Sweep(live, listedAt)
+	s.logDialogStats()
+}
+
+func (s *Server) logDialogStats() {
+	stats := s.dialogGC.Stats()
+	s.Log.Debug("swept dialog bindings",
+		"entities", stats.Entities,
+		"dialogs", stats.Dialogs,
+		"bindings", stats.Bindings,
+		"released", stats.Released,
+		"swept", stats.Swept,
+		"expired", stats.Expired,
+	)
+}
+
+func keyIDs(list []*ari.Key) map[string]bool {
+	ret := make(map[string]bool, len(list))
+	for _, k := range list {
+		ret[k.ID] = true
+	}
+	return ret
+}
+
+// DialogStats returns the current dialog binding counts and the activity of
+// the dialog binding garbage collector.  It returns the zero value if the
+// server is not running.
+func (s *Server) DialogStats() dialog.GCStats {
+	if s.dialogGC == nil {
+		return dialog.GCStats{}
+	}
+	return s.dialogGC.Stats()
+}
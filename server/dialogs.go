@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"sort"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+func (s *Server) dialogList(ctx context.Context, reply string, req *proxy.Request) {
+	dialogs := make(map[string]bool)
+	for _, b := range s.Dialog.Bindings() {
+		for _, d := range b.Dialogs {
+			dialogs[d] = true
+		}
+	}
+
+	ids := make([]string, 0, len(dialogs))
+	for d := range dialogs {
+		ids = append(ids, d)
+	}
+	sort.Strings(ids)
+
+	list := make([]*ari.Key, 0, len(ids))
+	for _, d := range ids {
+		list = append(list, ari.NewKey(proxy.DialogKey, d, ari.WithDialog(d)))
+	}
+
+	s.publish(reply, &proxy.Response{
+		Keys: list,
+	})
+}
+
+func (s *Server) dialogBindings(ctx context.Context, reply string, req *proxy.Request) {
+	if req.Key == nil || req.Key.Dialog == "" {
+		s.sendError(reply, eris.New("dialog is mandatory"))
+		return
+	}
+	dialog := req.Key.Dialog
+
+	var list []*ari.Key
+	for _, b := range s.Dialog.Bindings() {
+		for _, d := range b.Dialogs {
+			if d == dialog {
+				list = append(list, ari.NewKey(b.Type, b.ID, ari.WithDialog(dialog)))
+				break
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind < list[j].Kind
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	s.publish(reply, &proxy.Response{
+		Keys: list,
+	})
+}
+
+func (s *Server) dialogBind(ctx context.Context, reply string, req *proxy.Request) {
+	if req.Key == nil || req.Key.Dialog == "" || req.Key.Kind == "" || req.Key.ID == "" {
+		s.sendError(reply, eris.New("dialog, entity kind, and entity ID are mandatory"))
+		return
+	}
+
+	s.Dialog.Bind(req.Key.Dialog, req.Key.Kind, req.Key.ID)
+
+	s.publish(reply, &proxy.Response{})
+}
+
+func (s *Server) dialogUnbind(ctx context.Context, reply string, req *proxy.Request) {
+	if req.Key == nil || req.Key.Kind == "" || req.Key.ID == "" {
+		s.sendError(reply, eris.New("entity kind and entity ID are mandatory"))
+		return
+	}
+
+	if req.Key.Dialog == "" {
+		s.Dialog.Unbind(req.Key.Kind, req.Key.ID)
+	} else {
+		s.Dialog.Detach(req.Key.Dialog, req.Key.Kind, req.Key.ID)
+	}
+
+	s.publish(reply, &proxy.Response{})
+}
+
+func (s *Server) dialogClose(ctx context.Context, reply string, req *proxy.Request) {
+	if req.Key == nil || req.Key.Dialog == "" {
+		s.sendError(reply, eris.New("dialog is mandatory"))
+		return
+	}
+
+	s.Dialog.UnbindDialog(req.Key.Dialog)
+
+	s.publish(reply, &proxy.Response{})
+}
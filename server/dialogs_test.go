@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func dialogRequest(s *Server, kind string, key *ari.Key) *proxy.Response {
+	var resp *proxy.Response
+	s.dispatchRequest(context.Background(), s.interceptReply(func(r *proxy.Response) {
+		resp = r
+	}), &proxy.Request{
+		Kind: kind,
+		Key:  key,
+	})
+	return resp
+}
+
+func TestDialogRequests(t *testing.T) {
+	s := New()
+
+	for _, k := range []*ari.Key{
+		ari.NewKey(ari.ChannelKey, "c1", ari.WithDialog("d1")),
+		ari.NewKey(ari.BridgeKey, "b1", ari.WithDialog("d1")),
+		ari.NewKey(ari.ChannelKey, "c1", ari.WithDialog("d2")),
+	} {
+		if err := dialogRequest(s, "DialogBind", k).Err(); err != nil {
+			t.Fatalf("failed to bind %s: %v", k, err)
+		}
+	}
+
+	if resp := dialogRequest(s, "DialogBind", ari.NewKey(ari.ChannelKey, "c1")); resp.Err() == nil {
+		t.Error("bind without a dialog should have failed")
+	}
+
+	resp := dialogRequest(s, "DialogList", nil)
+	if len(resp.Keys) != 2 || resp.Keys[0].ID != "d1" || resp.Keys[1].ID != "d2" {
+		t.Errorf("unexpected dialog list: %v", resp.Keys)
+	}
+
+	resp = dialogRequest(s, "DialogBindings", ari.NewKey(proxy.DialogKey, "d1", ari.WithDialog("d1")))
+	if len(resp.Keys) != 2 || resp.Keys[0].Kind != ari.BridgeKey || resp.Keys[1].Kind != ari.ChannelKey {
+		t.Errorf("unexpected bindings: %v", resp.Keys)
+	}
+
+	dialogRequest(s, "DialogUnbind", ari.NewKey(ari.ChannelKey, "c1", ari.WithDialog("d1")))
+	if list := s.Dialog.List(ari.ChannelKey, "c1"); len(list) != 1 || list[0] != "d2" {
+		t.Errorf("unbind should only remove the given dialog: %v", list)
+	}
+
+	dialogRequest(s, "DialogClose", ari.NewKey(proxy.DialogKey, "d1", ari.WithDialog("d1")))
+	if len(s.Dialog.List(ari.BridgeKey, "b1")) != 0 {
+		t.Error("closed dialog remains bound")
+	}
+
+	dialogRequest(s, "DialogUnbind", ari.NewKey(ari.ChannelKey, "c1"))
+	if len(s.Dialog.List(ari.ChannelKey, "c1")) != 0 {
+		t.Error("unbind without a dialog should remove all dialogs")
+	}
+}
@@ -0,0 +1,181 @@
+// Package eventbuf provides a bounded, in-memory buffer of the recent events
+// published by an ARI proxy server, indexed by sequence number and by entity,
+// from which clients may recover events which they missed.
+package eventbuf
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// DefaultSize is the default maximum number of events retained
+var DefaultSize = 10000
+
+// Entry is a buffered event
+type Entry struct {
+	// Seq is the sequence number of the event
+	Seq uint64
+
+	// Time is the time at which the event was published
+	Time time.Time
+
+	// Event is the event, as it was published.  It is encoded only when
+	// it is replayed, so it must not be modified once buffered.
+	Event ari.Event
+
+	// entities are the index keys of the entities which the event concerns
+	entities []string
+}
+
+// Buffer is a bounded ring buffer of events, ordered by sequence number
+type Buffer struct {
+	// ring holds the entries; the oldest is at start
+	ring  []*Entry
+	start int
+	count int
+
+	// entities indexes the sequence numbers of the buffered events of each entity, in order
+	entities map[string][]uint64
+
+	// evicted is the newest entry which has been evicted, if any
+	evicted *Entry
+
+	mu sync.RWMutex
+}
+
+// New returns a new Buffer which retains up to the given number of events.  A
+// non-positive size selects the default.
+func New(size int) *Buffer {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	return &Buffer{
+		ring:     make([]*Entry, size),
+		entities: make(map[string][]uint64),
+	}
+}
+
+func entityIndex(k *ari.Key) string {
+	return k.Kind + "/" + k.ID
+}
+
+// Add buffers an event, which must have a greater sequence number than every
+// event previously added, evicting the oldest event if the buffer is full.
+func (b *Buffer) Add(seq uint64, at time.Time, event ari.Event) {
+	e := &Entry{
+		Seq:   seq,
+		Time:  at,
+		Event: event,
+	}
+
+	seen := make(map[string]bool)
+	for _, k := range event.Keys() {
+		if k == nil || k.Kind == "" || k.ID == "" {
+			continue
+		}
+		if idx := entityIndex(k); !seen[idx] {
+			seen[idx] = true
+			e.entities = append(e.entities, idx)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.count == len(b.ring) {
+		b.evict()
+	}
+
+	b.ring[(b.start+b.count)%len(b.ring)] = e
+	b.count++
+
+	for _, idx := range e.entities {
+		b.entities[idx] = append(b.entities[idx], seq)
+	}
+}
+
+// evict removes the oldest entry
+func (b *Buffer) evict() {
+	old := b.ring[b.start]
+	b.evicted = old
+	b.ring[b.start] = nil
+	b.start = (b.start + 1) % len(b.ring)
+	b.count--
+
+	for _, idx := range old.entities {
+		list := b.entities[idx]
+		if len(list) > 0 && list[0] == old.Seq {
+			list = list[1:]
+		}
+		if len(list) == 0 {
+			delete(b.entities, idx)
+			continue
+		}
+		b.entities[idx] = list
+	}
+}
+
+// at returns the i'th oldest entry
+func (b *Buffer) at(i int) *Entry {
+	return b.ring[(b.start+i)%len(b.ring)]
+}
+
+// find returns the position of the first entry whose sequence number is at least seq
+func (b *Buffer) find(seq uint64) int {
+	return sort.Search(b.count, func(i int) bool {
+		return b.at(i).Seq >= seq
+	})
+}
+
+// Range returns the sequence numbers of the oldest and newest buffered
+// events.  Both are zero if the buffer is empty.
+func (b *Buffer) Range() (first, last uint64) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.count == 0 {
+		return 0, 0
+	}
+	return b.at(0).Seq, b.at(b.count - 1).Seq
+}
+
+// Since returns the buffered events whose sequence numbers are at least seq,
+// oldest first.  It also indicates whether the buffer still holds every such
+// event; that is, whether no event from seq onward has been evicted.
+func (b *Buffer) Since(seq uint64) (ret []*Entry, complete bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for i := b.find(seq); i < b.count; i++ {
+		ret = append(ret, b.at(i))
+	}
+	return ret, b.evicted == nil || seq > b.evicted.Seq
+}
+
+// ForEntity returns the buffered events which concern the given entity and
+// were published at or after the given time, oldest first.  It also indicates
+// whether the buffer still holds every event published since that time.
+func (b *Buffer) ForEntity(k *ari.Key, since time.Time) (ret []*Entry, complete bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	complete = b.evicted == nil || since.After(b.evicted.Time)
+	if k == nil {
+		return nil, complete
+	}
+
+	for _, seq := range b.entities[entityIndex(k)] {
+		i := b.find(seq)
+		if i >= b.count {
+			continue
+		}
+		if e := b.at(i); e.Seq == seq && !e.Time.Before(since) {
+			ret = append(ret, e)
+		}
+	}
+	return ret, complete
+}
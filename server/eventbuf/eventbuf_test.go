@@ -0,0 +1,60 @@
+package eventbuf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func fill(b *Buffer, start time.Time, n int) {
+	for i := 1; i <= n; i++ {
+		e := &ari.ChannelVarset{Channel: ari.ChannelData{ID: "c1"}}
+		if i%2 == 0 {
+			e.Channel.ID = "c2"
+		}
+		b.Add(uint64(i), start.Add(time.Duration(i)*time.Second), e)
+	}
+}
+
+func TestSince(t *testing.T) {
+	b := New(4)
+	fill(b, time.Now(), 6)
+
+	if first, last := b.Range(); first != 3 || last != 6 {
+		t.Errorf("unexpected range %d-%d", first, last)
+	}
+
+	events, complete := b.Since(4)
+	if !complete || len(events) != 3 || events[0].Seq != 4 {
+		t.Errorf("unexpected events since 4: %d (complete: %v)", len(events), complete)
+	}
+
+	events, complete = b.Since(1)
+	if complete || len(events) != 4 || events[0].Seq != 3 {
+		t.Errorf("unexpected events since evicted 1: %d (complete: %v)", len(events), complete)
+	}
+}
+
+func TestForEntity(t *testing.T) {
+	start := time.Now()
+	b := New(4)
+	fill(b, start, 6)
+
+	events, complete := b.ForEntity(ari.NewKey(ari.ChannelKey, "c1"), time.Time{})
+	if complete {
+		t.Error("events since the zero time have been evicted")
+	}
+	if len(events) != 2 || events[0].Seq != 3 || events[1].Seq != 5 {
+		t.Errorf("unexpected events for entity: %d", len(events))
+	}
+
+	events, complete = b.ForEntity(ari.NewKey(ari.ChannelKey, "c2"), start.Add(5*time.Second))
+	if !complete || len(events) != 1 || events[0].Seq != 6 {
+		t.Errorf("unexpected events for entity since time: %d", len(events))
+	}
+
+	if len(b.entities) != 2 || len(b.entities["channel/c1"]) != 2 {
+		t.Errorf("entity index was not pruned on eviction: %v", b.entities)
+	}
+}
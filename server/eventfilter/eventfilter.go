@@ -0,0 +1,189 @@
+// Package eventfilter provides the filtering, by event type and by the
+// entities they concern, of the events which an ARI proxy server publishes to
+// its canonical event subject.
+package eventfilter
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// DefaultApplication is the Config key whose Rule applies to each
+// application which does not have a Rule of its own.
+const DefaultApplication = "*"
+
+// Rule describes the events to publish
+type Rule struct {
+	// Allow is the list of event types to publish.  If it is empty, all event
+	// types which are not denied are published.
+	Allow []string `mapstructure:"allow"`
+
+	// Deny is the list of event types not to publish
+	Deny []string `mapstructure:"deny"`
+
+	// AllowEntities is the list of entities whose events are published, each
+	// either an entity kind (such as "bridge"), matching every entity of that
+	// kind, or a kind and ID (such as "bridge:conference").  If it is empty,
+	// the events of all entities which are not denied are published.
+	AllowEntities []string `mapstructure:"allow_entities"`
+
+	// DenyEntities is the list of entities, in the form of AllowEntities, whose
+	// events are not published
+	DenyEntities []string `mapstructure:"deny_entities"`
+}
+
+// Config describes the Rule for each ARI application.  The DefaultApplication
+// entry, if present, applies to every application which is not otherwise
+// listed.
+type Config map[string]Rule
+
+// Rule returns the Rule which applies to the given application
+func (c Config) Rule(app string) Rule {
+	for k, r := range c {
+		if strings.EqualFold(k, app) {
+			return r
+		}
+	}
+	return c[DefaultApplication]
+}
+
+// Filter decides which events are published, counting those which are not
+type Filter struct {
+	rule Rule
+
+	allow map[string]bool
+	deny  map[string]bool
+
+	allowEntities entitySet
+	denyEntities  entitySet
+
+	dropped map[string]int64
+
+	mu sync.RWMutex
+}
+
+// New returns a Filter for the given Rule
+func New(r Rule) *Filter {
+	f := &Filter{
+		dropped: make(map[string]int64),
+	}
+	f.Set(r)
+	return f
+}
+
+// Set replaces the Rule of the Filter.  Drop counts are retained.
+func (f *Filter) Set(r Rule) {
+	allow := make(map[string]bool, len(r.Allow))
+	for _, t := range r.Allow {
+		allow[strings.ToLower(t)] = true
+	}
+	deny := make(map[string]bool, len(r.Deny))
+	for _, t := range r.Deny {
+		deny[strings.ToLower(t)] = true
+	}
+
+	f.mu.Lock()
+	f.rule = Rule{
+		Allow:         append([]string(nil), r.Allow...),
+		Deny:          append([]string(nil), r.Deny...),
+		AllowEntities: append([]string(nil), r.AllowEntities...),
+		DenyEntities:  append([]string(nil), r.DenyEntities...),
+	}
+	f.allow = allow
+	f.deny = deny
+	f.allowEntities = newEntitySet(r.AllowEntities)
+	f.denyEntities = newEntitySet(r.DenyEntities)
+	f.mu.Unlock()
+}
+
+// Rule returns the current Rule of the Filter
+func (f *Filter) Rule() Rule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.rule
+}
+
+// Allow indicates whether events of the given type should be published.  Events which should not are counted as dropped.
+func (f *Filter) Allow(eventType string) bool {
+	f.mu.RLock()
+	ok := f.allowType(eventType)
+	f.mu.RUnlock()
+
+	if !ok {
+		f.drop(eventType)
+	}
+	return ok
+}
+
+// AllowEvent indicates whether the given event should be published, by its
+// type and the entities it concerns.  Events which should not are counted as
+// dropped.
+func (f *Filter) AllowEvent(e ari.Event) bool {
+	f.mu.RLock()
+	ok := f.allowType(e.GetType())
+	if ok && (len(f.allowEntities) > 0 || len(f.denyEntities) > 0) {
+		keys := e.Keys()
+		ok = !f.denyEntities.matchAny(keys) && (len(f.allowEntities) == 0 || f.allowEntities.matchAny(keys))
+	}
+	f.mu.RUnlock()
+
+	if !ok {
+		f.drop(e.GetType())
+	}
+	return ok
+}
+
+// allowType indicates whether the rule allows events of the given type.  The
+// caller must hold the lock.
+func (f *Filter) allowType(eventType string) bool {
+	t := strings.ToLower(eventType)
+	return !f.deny[t] && (len(f.allow) == 0 || f.allow[t])
+}
+
+func (f *Filter) drop(eventType string) {
+	f.mu.Lock()
+	f.dropped[eventType]++
+	f.mu.Unlock()
+}
+
+// Dropped returns the number of events which have been dropped, by event type
+func (f *Filter) Dropped() map[string]int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	ret := make(map[string]int64, len(f.dropped))
+	for k, v := range f.dropped {
+		ret[k] = v
+	}
+	return ret
+}
+
+// entitySet is a set of entities, indexed by kind.  An empty ID matches every
+// entity of its kind.
+type entitySet map[string]map[string]bool
+
+func newEntitySet(list []string) entitySet {
+	ret := make(entitySet, len(list))
+	for _, e := range list {
+		kind, id, _ := strings.Cut(e, ":")
+		kind = strings.ToLower(kind)
+		if ret[kind] == nil {
+			ret[kind] = make(map[string]bool)
+		}
+		ret[kind][id] = true
+	}
+	return ret
+}
+
+// matchAny indicates whether any of the given keys is in the set
+func (s entitySet) matchAny(keys ari.Keys) bool {
+	for _, k := range keys {
+		if ids, ok := s[strings.ToLower(k.Kind)]; ok && (ids[""] || ids[k.ID]) {
+			return true
+		}
+	}
+	return false
+}
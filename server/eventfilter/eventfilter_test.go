@@ -0,0 +1,99 @@
+package eventfilter
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestDeny(t *testing.T) {
+	f := New(Rule{Deny: []string{"ChannelVarset", "channeldialplan"}})
+
+	if f.Allow("ChannelVarset") || f.Allow("ChannelDialplan") {
+		t.Error("denied event types should not be allowed")
+	}
+	if !f.Allow("StasisStart") {
+		t.Error("other event types should be allowed")
+	}
+
+	if n := f.Dropped()["ChannelVarset"]; n != 1 {
+		t.Errorf("dropped count %d != 1", n)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	f := New(Rule{
+		Allow: []string{"StasisStart", "StasisEnd", "ChannelVarset"},
+		Deny:  []string{"ChannelVarset"},
+	})
+
+	if !f.Allow("StasisStart") {
+		t.Error("allowed event type should be allowed")
+	}
+	if f.Allow("ChannelVarset") {
+		t.Error("denial should take precedence over allowance")
+	}
+	if f.Allow("ChannelDtmfReceived") {
+		t.Error("unlisted event type should not be allowed")
+	}
+}
+
+func TestSet(t *testing.T) {
+	f := New(Rule{Deny: []string{"ChannelVarset"}})
+	f.Allow("ChannelVarset")
+
+	f.Set(Rule{})
+	if !f.Allow("ChannelVarset") {
+		t.Error("replaced rule should no longer apply")
+	}
+	if n := f.Dropped()["ChannelVarset"]; n != 1 {
+		t.Errorf("drop counts should be retained; %d != 1", n)
+	}
+}
+
+func TestConfigRule(t *testing.T) {
+	c := Config{
+		DefaultApplication: {Deny: []string{"ChannelVarset"}},
+		"Example":          {Allow: []string{"StasisStart"}},
+	}
+
+	if r := c.Rule("example"); len(r.Allow) != 1 {
+		t.Errorf("unexpected rule for listed application: %+v", r)
+	}
+	if r := c.Rule("other"); len(r.Deny) != 1 {
+		t.Errorf("unexpected rule for unlisted application: %+v", r)
+	}
+}
+
+func TestEntities(t *testing.T) {
+	f := New(Rule{
+		AllowEntities: []string{"Channel", "bridge:conference"},
+		DenyEntities:  []string{"channel:spy"},
+	})
+
+	channel := func(id string) ari.Event {
+		return &ari.ChannelDtmfReceived{EventData: ari.EventData{Type: "ChannelDtmfReceived"}, Channel: ari.ChannelData{ID: id}}
+	}
+	bridge := func(id string) ari.Event {
+		return &ari.BridgeCreated{EventData: ari.EventData{Type: "BridgeCreated"}, Bridge: ari.BridgeData{ID: id}}
+	}
+
+	if !f.AllowEvent(channel("c1")) {
+		t.Error("events of an allowed entity kind should be allowed")
+	}
+	if f.AllowEvent(channel("spy")) {
+		t.Error("events of a denied entity should not be allowed")
+	}
+	if !f.AllowEvent(bridge("conference")) {
+		t.Error("events of an allowed entity should be allowed")
+	}
+	if f.AllowEvent(bridge("other")) {
+		t.Error("events of an unlisted entity should not be allowed")
+	}
+	if n := f.Dropped()["BridgeCreated"]; n != 1 {
+		t.Errorf("dropped count %d != 1", n)
+	}
+	if r := f.Rule(); len(r.AllowEntities) != 2 || len(r.DenyEntities) != 1 {
+		t.Errorf("unexpected rule: %+v", r)
+	}
+}
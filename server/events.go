@@ -1,6 +1,98 @@
 package server
 
-import "github.com/CyCoreSystems/ari/v5"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/eventbuf"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/eventfilter"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// Event subject modes, which select the subjects to which events are published
+const (
+	// EventSubjectsLegacy publishes each event to <prefix>event.<app>.<node>
+	EventSubjectsLegacy = "legacy"
+
+	// EventSubjectsTyped publishes each event to the typed event subjects (see
+	// proxy.TypedEventSubject): once for the event itself and once for each
+	// entity which it concerns, allowing subscribers to filter by event type
+	// and entity within the MessageBus
+	EventSubjectsTyped = "typed"
+
+	// EventSubjectsCompat publishes each event to both the legacy and the typed event subjects
+	EventSubjectsCompat = "compat"
+)
+
+// sequenceEvent stamps the event with the next number in the server's event
+// sequence and, for the StasisStart events whose channels are offered to be
+// claimed, with the mark of the offer
+func (s *Server) sequenceEvent(e ari.Event) *proxy.SequencedEvent {
+	return &proxy.SequencedEvent{
+		Event: e,
+		EventSequence: proxy.EventSequence{
+			Seq:     atomic.AddUint64(&s.eventSeq, 1),
+			Boot:    s.bootID,
+			Offered: s.ClaimTimeout > 0 && e.GetType() == "StasisStart",
+		},
+	}
+}
+
+// bufferEvent retains the sequenced event for replay.  It is encoded only if
+// it is replayed.
+func (s *Server) bufferEvent(se *proxy.SequencedEvent) {
+	if s.EventBuffer == nil {
+		return
+	}
+	s.EventBuffer.Add(se.Seq, time.Now(), se)
+}
+
+// eventNamespaces are the namespaces, under the MBPrefix, of the subjects on
+// which the ARI proxies publish current events
+var eventNamespaces = []string{"event.", "typedevent.", "dialogevent.", "claim."}
+
+// eventSubject indicates whether the given subject is one on which the ARI
+// proxies publish current events.  Replayed events must not be re-published to
+// them, where they would pass for current events.
+func (s *Server) eventSubject(subj string) bool {
+	if !strings.HasPrefix(subj, s.MBPrefix) {
+		return false
+	}
+	for _, ns := range eventNamespaces {
+		if strings.HasPrefix(subj[len(s.MBPrefix):], ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishCanonicalEvent publishes the event to its canonical subjects, as selected by the EventSubjects mode
+func (s *Server) publishCanonicalEvent(e ari.Event) {
+	if s.EventSubjects != EventSubjectsTyped {
+		s.publishEvent(fmt.Sprintf("%sevent.%s.%s", s.MBPrefix, s.Application, s.AsteriskID), e)
+	}
+	if s.EventSubjects != EventSubjectsTyped && s.EventSubjects != EventSubjectsCompat {
+		return
+	}
+
+	eType := e.GetType()
+	s.publishEvent(proxy.TypedEventSubject(s.MBPrefix, s.Application, s.AsteriskID, eType, "", ""), e)
+
+	seen := make(map[string]bool)
+	for _, k := range e.Keys() {
+		if k == nil || k.Kind == "" || k.ID == "" || seen[k.Kind+":"+k.ID] {
+			continue
+		}
+		seen[k.Kind+":"+k.ID] = true
+		s.publishEvent(proxy.TypedEventSubject(s.MBPrefix, s.Application, s.AsteriskID, eType, k.Kind, k.ID), e)
+	}
+}
 
 func (s *Server) dialogsForEvent(e ari.Event) (ret []string) {
 	for _, k := range e.Keys() {
@@ -12,3 +104,94 @@ func (s *Server) dialogsForEvent(e ari.Event) (ret []string) {
 	}
 	return
 }
+
+func (s *Server) eventFilter(ctx context.Context, reply string, req *proxy.Request) {
+	ret := new(proxy.EventFilter)
+	if s.EventFilter != nil {
+		r := s.EventFilter.Rule()
+		ret.Allow = r.Allow
+		ret.Deny = r.Deny
+		ret.AllowEntities = r.AllowEntities
+		ret.DenyEntities = r.DenyEntities
+		ret.Dropped = s.EventFilter.Dropped()
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key:         ari.NewKey("", "", ari.WithApp(s.Application), ari.WithNode(s.AsteriskID)),
+		EventFilter: ret,
+	})
+}
+
+func (s *Server) eventFilterSet(ctx context.Context, reply string, req *proxy.Request) {
+	if s.EventFilter == nil {
+		s.sendError(reply, eris.New("event filtering is disabled"))
+		return
+	}
+
+	var r eventfilter.Rule
+	if req.EventFilter != nil {
+		r.Allow = req.EventFilter.Allow
+		r.Deny = req.EventFilter.Deny
+		r.AllowEntities = req.EventFilter.AllowEntities
+		r.DenyEntities = req.EventFilter.DenyEntities
+	}
+	s.EventFilter.Set(r)
+	s.Log.Info("event filter updated", "allow", r.Allow, "deny", r.Deny, "allow_entities", r.AllowEntities, "deny_entities", r.DenyEntities, "client", req.Client)
+
+	s.publish(reply, &proxy.Response{})
+}
+
+func (s *Server) eventReplay(ctx context.Context, reply string, req *proxy.Request) {
+	if s.EventBuffer == nil {
+		s.sendError(reply, eris.New("event replay is disabled"))
+		return
+	}
+	if req.EventReplay == nil {
+		s.sendError(reply, eris.New("no event replay request"))
+		return
+	}
+	r := req.EventReplay
+	if s.eventSubject(r.Subject) {
+		s.sendError(reply, eris.Errorf("events may not be replayed to the event subject %s", r.Subject))
+		return
+	}
+
+	var (
+		entries  []*eventbuf.Entry
+		complete bool
+	)
+	if r.Entity != nil {
+		entries, complete = s.EventBuffer.ForEntity(r.Entity, r.Since)
+	} else {
+		entries, complete = s.EventBuffer.Since(r.FromSeq)
+	}
+	if r.Limit > 0 && len(entries) > r.Limit {
+		entries = entries[:r.Limit]
+	}
+
+	ret := &proxy.EventReplayResult{
+		Boot:     s.bootID,
+		Complete: complete,
+		Count:    len(entries),
+	}
+	ret.First, ret.Last = s.EventBuffer.Range()
+
+	for _, entry := range entries {
+		if r.Subject != "" {
+			s.publishEvent(r.Subject, entry.Event)
+			continue
+		}
+
+		data, err := json.Marshal(entry.Event)
+		if err != nil {
+			s.Log.Warn("failed to encode buffered event", "error", err)
+			continue
+		}
+		ret.Events = append(ret.Events, data)
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key:         ari.NewKey("", "", ari.WithApp(s.Application), ari.WithNode(s.AsteriskID)),
+		EventReplay: ret,
+	})
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/eventbuf"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestEventFilterRequests(t *testing.T) {
+	s := New()
+
+	var resp *proxy.Response
+	s.dispatchRequest(context.Background(), s.interceptReply(func(r *proxy.Response) {
+		resp = r
+	}), &proxy.Request{
+		Kind: "EventFilterSet",
+		EventFilter: &proxy.EventFilter{
+			Deny:         []string{"ChannelVarset"},
+			DenyEntities: []string{"bridge"},
+		},
+	})
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.EventFilter.Allow("ChannelVarset") {
+		t.Error("denied event type was allowed")
+	}
+
+	s.dispatchRequest(context.Background(), s.interceptReply(func(r *proxy.Response) {
+		resp = r
+	}), &proxy.Request{
+		Kind: "EventFilter",
+	})
+
+	f := resp.EventFilter
+	if f == nil || len(f.Deny) != 1 || f.Deny[0] != "ChannelVarset" || len(f.DenyEntities) != 1 {
+		t.Fatalf("unexpected event filter: %+v", f)
+	}
+	if f.Dropped["ChannelVarset"] != 1 {
+		t.Errorf("dropped count %d != 1", f.Dropped["ChannelVarset"])
+	}
+}
+
+type eventRecorder struct {
+	messagebus.Server
+
+	subjects []string
+
+	mu sync.Mutex
+}
+
+func (r *eventRecorder) PublishEvent(topic string, msg ari.Event) error {
+	r.mu.Lock()
+	r.subjects = append(r.subjects, topic)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *eventRecorder) count(subject string) (n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.subjects {
+		if s == subject {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPublishCanonicalEvent(t *testing.T) {
+	e := &ari.ChannelEnteredBridge{
+		EventData: ari.EventData{Type: "ChannelEnteredBridge"},
+		Bridge:    ari.BridgeData{Key: ari.NewKey(ari.BridgeKey, "b1"), ID: "b1"},
+		Channel:   ari.ChannelData{Key: ari.NewKey(ari.ChannelKey, "c1"), ID: "c1"},
+	}
+
+	for mode, expected := range map[string][]string{
+		EventSubjectsLegacy: {"ari.event.test.n1"},
+		EventSubjectsTyped: {
+			"ari.typedevent.test.n1.ChannelEnteredBridge",
+			"ari.typedevent.test.n1.ChannelEnteredBridge.bridge.b1",
+			"ari.typedevent.test.n1.ChannelEnteredBridge.channel.c1",
+		},
+		EventSubjectsCompat: {
+			"ari.event.test.n1",
+			"ari.typedevent.test.n1.ChannelEnteredBridge",
+			"ari.typedevent.test.n1.ChannelEnteredBridge.bridge.b1",
+			"ari.typedevent.test.n1.ChannelEnteredBridge.channel.c1",
+		},
+	} {
+		rec := &eventRecorder{}
+
+		s := New()
+		s.mbus = rec
+		s.Application = "test"
+		s.AsteriskID = "n1"
+		s.EventSubjects = mode
+
+		s.publishCanonicalEvent(e)
+
+		sort.Strings(rec.subjects)
+		if strings.Join(rec.subjects, " ") != strings.Join(expected, " ") {
+			t.Errorf("%s: unexpected subjects: %v", mode, rec.subjects)
+		}
+	}
+}
+
+func TestSequenceEvent(t *testing.T) {
+	s := New()
+
+	for i := uint64(1); i <= 2; i++ {
+		se := s.sequenceEvent(&ari.StasisStart{EventData: ari.EventData{Type: "StasisStart"}})
+		if se.Seq != i || se.Boot == "" || se.Boot != s.bootID {
+			t.Errorf("unexpected sequence: %+v", se.EventSequence)
+		}
+	}
+
+	data, err := json.Marshal(s.sequenceEvent(&ari.StasisStart{EventData: ari.EventData{Type: "StasisStart"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := ari.DecodeEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.(*ari.StasisStart); !ok {
+		t.Errorf("sequenced event did not decode as its original type: %s", data)
+	}
+}
+
+func TestEventReplay(t *testing.T) {
+	rec := &eventRecorder{}
+
+	s := New()
+	s.mbus = rec
+	s.EventBuffer = eventbuf.New(10)
+
+	for _, id := range []string{"c1", "c2", "c1"} {
+		s.bufferEvent(s.sequenceEvent(&ari.ChannelVarset{
+			EventData: ari.EventData{Type: "ChannelVarset"},
+			Channel:   ari.ChannelData{Key: ari.NewKey(ari.ChannelKey, id), ID: id},
+		}))
+	}
+
+	replay := func(r *proxy.EventReplay) *proxy.EventReplayResult {
+		var resp *proxy.Response
+		s.dispatchRequest(context.Background(), s.interceptReply(func(r *proxy.Response) {
+			resp = r
+		}), &proxy.Request{
+			Kind:        "EventReplay",
+			EventReplay: r,
+		})
+		if err := resp.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return resp.EventReplay
+	}
+
+	ret := replay(&proxy.EventReplay{FromSeq: 2})
+	if ret.Boot != s.bootID || !ret.Complete || ret.First != 1 || ret.Last != 3 || len(ret.Events) != 2 {
+		t.Fatalf("unexpected replay from sequence: %+v", ret)
+	}
+	se, err := proxy.DecodeSequencedEvent(ret.Events[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if se.Seq != 2 {
+		t.Errorf("unexpected first replayed event: %d", se.Seq)
+	}
+
+	ret = replay(&proxy.EventReplay{Entity: ari.NewKey(ari.ChannelKey, "c1")})
+	if ret.Count != 2 || len(ret.Events) != 2 {
+		t.Errorf("unexpected replay for entity: %+v", ret)
+	}
+
+	ret = replay(&proxy.EventReplay{FromSeq: 1, Subject: "replay.test"})
+	if ret.Count != 3 || len(ret.Events) != 0 || len(rec.subjects) != 3 || rec.subjects[0] != "replay.test" {
+		t.Errorf("events were not re-published: %+v %v", ret, rec.subjects)
+	}
+
+	// Replayed events may not pass for current events
+	for _, subj := range []string{"ari.event.asdf.1", "ari.typedevent.asdf.1.ChannelVarset", "ari.dialogevent.d1"} {
+		var resp *proxy.Response
+		s.dispatchRequest(context.Background(), s.interceptReply(func(r *proxy.Response) {
+			resp = r
+		}), &proxy.Request{
+			Kind:        "EventReplay",
+			EventReplay: &proxy.EventReplay{FromSeq: 1, Subject: subj},
+		})
+		if resp.Err() == nil {
+			t.Errorf("expected replay to %s to be rejected", subj)
+		}
+	}
+	if len(rec.subjects) != 3 {
+		t.Errorf("events were re-published to an event subject: %v", rec.subjects)
+	}
+}
@@ -0,0 +1,107 @@
+// Package fallback provides the handling which an ARI proxy server applies
+// to a channel in Stasis which no application instance has taken control of.
+package fallback
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/ext/play"
+	"github.com/rotisserie/eris"
+)
+
+// Actions
+const (
+	// ActionNone leaves the channel alone
+	ActionNone = ""
+
+	// ActionContinue continues the channel in the dialplan at the Context,
+	// Extension and Priority of the Policy
+	ActionContinue = "continue"
+
+	// ActionPlay answers the channel, plays the Media of the Policy to it and
+	// hangs it up
+	ActionPlay = "play"
+
+	// ActionHangup hangs up the channel
+	ActionHangup = "hangup"
+)
+
+// DefaultPlayTimeout is the default maximum amount of time for which the
+// Media of an ActionPlay Policy is played
+var DefaultPlayTimeout = 2 * time.Minute
+
+// Policy describes the handling of a channel
+type Policy struct {
+	// Action is the action to take
+	Action string `mapstructure:"action"`
+
+	// Context, Extension and Priority are the dialplan location to which the
+	// channel is sent by ActionContinue.  Empty values leave the channel's
+	// current location unchanged.
+	Context   string `mapstructure:"context"`
+	Extension string `mapstructure:"extension"`
+	Priority  int    `mapstructure:"priority"`
+
+	// Media is the media URI (such as "sound:tt-allbusy") played by ActionPlay
+	Media string `mapstructure:"media"`
+
+	// Cause is the hangup reason (such as "normal", "busy" or "congestion")
+	// used by ActionHangup and ActionPlay.  It defaults to "normal".
+	Cause string `mapstructure:"cause"`
+}
+
+// DefaultApplication is the Config key whose Policy applies to each
+// application which does not have a Policy of its own
+const DefaultApplication = "*"
+
+// Config describes the Policy for each ARI application.  The
+// DefaultApplication entry, if present, applies to every application which is
+// not otherwise listed.
+type Config map[string]Policy
+
+// Policy returns the Policy which applies to the given application
+func (c Config) Policy(app string) Policy {
+	for k, p := range c {
+		if strings.EqualFold(k, app) {
+			return p
+		}
+	}
+	return c[DefaultApplication]
+}
+
+// Run applies the Policy to the channel with the given key
+func Run(ctx context.Context, ac ari.Client, key *ari.Key, p Policy) error {
+	cause := p.Cause
+	if cause == "" {
+		cause = "normal"
+	}
+
+	switch p.Action {
+	case ActionNone:
+		return nil
+	case ActionContinue:
+		return ac.Channel().Continue(key, p.Context, p.Extension, p.Priority)
+	case ActionHangup:
+		return ac.Channel().Hangup(key, cause)
+	case ActionPlay:
+		if err := ac.Channel().Answer(key); err != nil {
+			return eris.Wrap(err, "failed to answer channel")
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, DefaultPlayTimeout)
+		defer cancel()
+
+		h := ari.NewChannelHandle(key, ac.Channel(), nil)
+		if err := play.Play(ctx, h, play.URI(p.Media)).Err(); err != nil {
+			// Hang up regardless
+			ac.Channel().Hangup(key, cause) // nolint: errcheck
+			return eris.Wrap(err, "failed to play media")
+		}
+		return ac.Channel().Hangup(key, cause)
+	default:
+		return eris.Errorf("unknown fallback action %q", p.Action)
+	}
+}
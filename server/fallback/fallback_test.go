@@ -0,0 +1,42 @@
+package fallback
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+func TestConfigPolicy(t *testing.T) {
+	c := Config{
+		DefaultApplication: {Action: ActionHangup},
+		"Example":          {Action: ActionContinue},
+	}
+
+	if p := c.Policy("example"); p.Action != ActionContinue {
+		t.Errorf("unexpected policy for listed application: %+v", p)
+	}
+	if p := c.Policy("other"); p.Action != ActionHangup {
+		t.Errorf("unexpected policy for unlisted application: %+v", p)
+	}
+}
+
+func TestRunHangup(t *testing.T) {
+	key := ari.NewKey(ari.ChannelKey, "c1")
+
+	ch := &arimocks.Channel{}
+	ch.On("Hangup", key, "normal").Return(nil)
+
+	cl := &arimocks.Client{}
+	cl.On("Channel").Return(ch)
+
+	if err := Run(context.Background(), cl, key, Policy{Action: ActionHangup}); err != nil {
+		t.Fatal(err)
+	}
+	ch.AssertExpectations(t)
+
+	if err := Run(context.Background(), cl, key, Policy{Action: "bogus"}); err == nil {
+		t.Error("unknown action should fail")
+	}
+}
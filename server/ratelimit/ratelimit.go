@@ -0,0 +1,233 @@
+// Package ratelimit provides token-bucket rate limiting of the requests
+// handled by an ARI proxy server.
+package ratelimit
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// DefaultClient is the Clients key whose Rate applies to each client which
+// does not have a Rate of its own.
+const DefaultClient = "*"
+
+// IdleExpiry is the amount of time after which the bucket of an idle client
+// is discarded.
+var IdleExpiry = 10 * time.Minute
+
+// Rate describes a token bucket
+type Rate struct {
+	// Rate is the number of requests per second which are allowed over time
+	Rate float64 `mapstructure:"rate"`
+
+	// Burst is the maximum number of requests which may be made at once.  If
+	// less than one, it defaults to the ceiling of Rate.
+	Burst int `mapstructure:"burst"`
+}
+
+func (r Rate) burst() float64 {
+	if r.Burst < 1 {
+		return math.Max(1, math.Ceil(r.Rate))
+	}
+	return float64(r.Burst)
+}
+
+// Config describes the set of limits to enforce.  Map keys are compared
+// case-insensitively.
+type Config struct {
+	// Kinds describes the limits for each request Kind.  Each client is
+	// limited separately.
+	Kinds map[string]Rate `mapstructure:"kinds"`
+
+	// Applications describes the limits for all requests to each ARI
+	// application, regardless of client.
+	Applications map[string]Rate `mapstructure:"applications"`
+
+	// Clients describes the limits for all requests from each client
+	// identity.  The DefaultClient entry, if present, applies to every client
+	// which is not otherwise listed.
+	Clients map[string]Rate `mapstructure:"clients"`
+}
+
+// Validate returns an error if any of the limits of the Config has no
+// positive Rate, since such a bucket would never refill
+func (c Config) Validate() error {
+	for name, set := range map[string]map[string]Rate{
+		"kinds":        c.Kinds,
+		"applications": c.Applications,
+		"clients":      c.Clients,
+	} {
+		for k, r := range set {
+			if r.Rate <= 0 {
+				return eris.Errorf("rate limit %s.%s must have a positive rate", name, k)
+			}
+		}
+	}
+	return nil
+}
+
+// Limiter enforces a set of rate limits
+type Limiter struct {
+	kinds        map[string]Rate
+	applications map[string]Rate
+	clients      map[string]Rate
+
+	buckets map[string]*bucket
+
+	throttled map[string]int64
+
+	lastPrune time.Time
+
+	now func() time.Time
+
+	mu sync.Mutex
+}
+
+// New returns a Limiter for the given Config
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		kinds:        lowerKeys(cfg.Kinds),
+		applications: lowerKeys(cfg.Applications),
+		clients:      lowerKeys(cfg.Clients),
+		buckets:      make(map[string]*bucket),
+		throttled:    make(map[string]int64),
+		now:          time.Now,
+	}
+}
+
+func lowerKeys(in map[string]Rate) map[string]Rate {
+	out := make(map[string]Rate, len(in))
+	for k, v := range in {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accrued since the last refill
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait returns the amount of time until a token will be available
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.rate <= 0 {
+		return IdleExpiry
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Allow consumes a token for a request of the given kind, to the given
+// application, from the given client.  If any applicable limit has been
+// reached, no token is consumed, and the returned duration indicates how
+// long the client should wait before retrying.
+func (l *Limiter) Allow(kind, app, client string) (bool, time.Duration) {
+	kind = strings.ToLower(kind)
+	app = strings.ToLower(app)
+	client = strings.ToLower(client)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	type applicable struct {
+		name string
+		b    *bucket
+	}
+	var list []applicable
+
+	if r, ok := l.kinds[kind]; ok {
+		list = append(list, applicable{"kind", l.bucket("k|"+kind+"|"+client, r, now)})
+	}
+	if r, ok := l.applications[app]; ok {
+		list = append(list, applicable{"application", l.bucket("a|"+app, r, now)})
+	}
+	if r, ok := l.clients[client]; ok {
+		list = append(list, applicable{"client", l.bucket("c|"+client, r, now)})
+	} else if r, ok := l.clients[DefaultClient]; ok {
+		list = append(list, applicable{"client", l.bucket("c|"+client, r, now)})
+	}
+
+	var wait time.Duration
+	var reason string
+	for _, a := range list {
+		a.b.refill(now)
+		if w := a.b.wait(); w > wait {
+			wait = w
+			reason = a.name
+		}
+	}
+	if wait > 0 {
+		l.throttled[reason]++
+		return false, wait
+	}
+
+	for _, a := range list {
+		a.b.tokens--
+	}
+	return true, 0
+}
+
+// bucket returns the named bucket, creating it (full) if it does not yet exist.  The caller must hold the lock.
+func (l *Limiter) bucket(name string, r Rate, now time.Time) *bucket {
+	b, ok := l.buckets[name]
+	if !ok {
+		b = &bucket{
+			rate:   r.Rate,
+			burst:  r.burst(),
+			tokens: r.burst(),
+			last:   now,
+		}
+		l.buckets[name] = b
+	}
+	return b
+}
+
+// prune discards buckets which have been idle for the IdleExpiry and have
+// since refilled completely, so that recreating them full changes nothing.
+// The caller must hold the lock.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < IdleExpiry {
+		return
+	}
+	l.lastPrune = now
+
+	for k, b := range l.buckets {
+		if now.Sub(b.last) <= IdleExpiry {
+			continue
+		}
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Throttled returns the number of requests which have been rejected, indexed
+// by the type of limit (kind, application, or client) which rejected them.
+func (l *Limiter) Throttled() map[string]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ret := make(map[string]int64, len(l.throttled))
+	for k, v := range l.throttled {
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestLimiter(cfg Config) (*Limiter, *time.Time) {
+	now := time.Unix(1000, 0)
+	l := New(cfg)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestKindLimit(t *testing.T) {
+	l, now := newTestLimiter(Config{
+		Kinds: map[string]Rate{"ChannelList": {Rate: 1, Burst: 2}},
+	})
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("ChannelList", "app", "clientA"); !ok {
+			t.Fatalf("request %d should have been allowed", i)
+		}
+	}
+
+	ok, wait := l.Allow("ChannelList", "app", "clientA")
+	if ok {
+		t.Fatal("request beyond burst should have been rejected")
+	}
+	if wait != time.Second {
+		t.Errorf("retry-after %s != 1s", wait)
+	}
+
+	// Other clients and kinds are unaffected
+	if ok, _ := l.Allow("ChannelList", "app", "clientB"); !ok {
+		t.Error("request from another client should have been allowed")
+	}
+	if ok, _ := l.Allow("ChannelAnswer", "app", "clientA"); !ok {
+		t.Error("request of another kind should have been allowed")
+	}
+
+	*now = now.Add(time.Second)
+	if ok, _ := l.Allow("ChannelList", "app", "clientA"); !ok {
+		t.Error("request after refill should have been allowed")
+	}
+
+	if n := l.Throttled()["kind"]; n != 1 {
+		t.Errorf("throttled count %d != 1", n)
+	}
+}
+
+func TestApplicationLimit(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Applications: map[string]Rate{"app": {Rate: 1}},
+	})
+
+	if ok, _ := l.Allow("ChannelList", "app", "clientA"); !ok {
+		t.Fatal("first request should have been allowed")
+	}
+	if ok, _ := l.Allow("ChannelAnswer", "app", "clientB"); ok {
+		t.Error("second request to the application should have been rejected")
+	}
+	if ok, _ := l.Allow("ChannelAnswer", "other", "clientB"); !ok {
+		t.Error("request to another application should have been allowed")
+	}
+}
+
+func TestDefaultClientLimit(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Clients: map[string]Rate{
+			DefaultClient: {Rate: 1},
+			"trusted":     {Rate: 100},
+		},
+	})
+
+	if ok, _ := l.Allow("ChannelList", "app", "clientA"); !ok {
+		t.Fatal("first request should have been allowed")
+	}
+	if ok, _ := l.Allow("ChannelList", "app", "clientA"); ok {
+		t.Error("second request should have been rejected")
+	}
+
+	for i := 0; i < 10; i++ {
+		if ok, _ := l.Allow("ChannelList", "app", "Trusted"); !ok {
+			t.Fatalf("trusted request %d should have been allowed", i)
+		}
+	}
+}
+
+func TestRejectionConsumesNothing(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Kinds:   map[string]Rate{"ChannelList": {Rate: 1}},
+		Clients: map[string]Rate{DefaultClient: {Rate: 1, Burst: 2}},
+	})
+
+	l.Allow("ChannelList", "app", "clientA")
+	if ok, _ := l.Allow("ChannelList", "app", "clientA"); ok {
+		t.Fatal("second ChannelList should have been rejected")
+	}
+
+	// The client bucket should still have a token left
+	if ok, _ := l.Allow("ChannelAnswer", "app", "clientA"); !ok {
+		t.Error("rejected request should not have consumed a client token")
+	}
+}
+
+func TestPruneSlowRate(t *testing.T) {
+	l, now := newTestLimiter(Config{
+		Kinds: map[string]Rate{"ChannelOriginate": {Rate: 0.001, Burst: 1}},
+	})
+
+	if ok, _ := l.Allow("ChannelOriginate", "app", "clientA"); !ok {
+		t.Fatal("first request should have been allowed")
+	}
+
+	// The bucket is idle beyond the expiry but has not refilled, so it must
+	// not be discarded
+	*now = now.Add(IdleExpiry + time.Second)
+	if ok, _ := l.Allow("ChannelOriginate", "app", "clientA"); ok {
+		t.Error("request before refill should have been rejected")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Config{Clients: map[string]Rate{DefaultClient: {Rate: 1}}}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Config{Kinds: map[string]Rate{"ChannelList": {Burst: 5}}}).Validate(); err == nil {
+		t.Error("expected a limit without a rate to be rejected")
+	}
+}
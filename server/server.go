@@ -5,13 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/messagebus"
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/audit"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dedupe"
 	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/eventbuf"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/eventfilter"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/fallback"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/ratelimit"
 	"github.com/CyCoreSystems/ari/v5"
 	"github.com/CyCoreSystems/ari/v5/client/native"
+	"github.com/CyCoreSystems/ari/v5/rid"
 	"github.com/nats-io/nats.go"
 	"github.com/rotisserie/eris"
 
@@ -36,6 +45,105 @@ type Server struct {
 	// Dialog is the dialog manager
 	Dialog dialog.Manager
 
+	// DialogSweepInterval is the interval at which dialog bindings are checked
+	// against the channels and bridges which exist in Asterisk, removing those
+	// whose entities no longer exist.  Sweeping is disabled if it is not
+	// positive.  Bindings are additionally removed whenever their entities are
+	// destroyed or finish.
+	DialogSweepInterval time.Duration
+
+	// DialogMaxAge is the age after which any dialog binding is removed by the
+	// sweep, even if its entity cannot be shown to have ended.  It is disabled
+	// if not positive.
+	DialogMaxAge time.Duration
+
+	// DialogPropagation describes the rules by which dialog bindings are
+	// automatically propagated to related entities.  No bindings are
+	// propagated if it has no rules.
+	DialogPropagation dialog.PropagationConfig
+
+	// dialogGC removes the bindings of entities which no longer exist
+	dialogGC *dialog.GC
+
+	// propagator propagates dialog bindings to related entities
+	propagator *dialog.Propagator
+
+	// Audit is the optional audit log to which all mutating (command and
+	// create) requests are recorded.
+	Audit *audit.Logger
+
+	// AuditPublish indicates that audit entries should additionally be
+	// published to the MessageBus audit subject.  It has no effect if Audit is
+	// nil.
+	AuditPublish bool
+
+	// Dedupe is the cache of responses to mutating requests, by which retried
+	// requests bearing the same idempotency key are answered without being
+	// executed again.  Deduplication is disabled if it is nil.
+	Dedupe *dedupe.Cache
+
+	// RateLimit is the optional rate limiter which is applied to all requests
+	RateLimit *ratelimit.Limiter
+
+	// EventSubjects selects the subjects to which events are published:
+	// EventSubjectsLegacy (the default), EventSubjectsCompat or
+	// EventSubjectsTyped.
+	EventSubjects string
+
+	// EventFilter decides which events are published to the canonical event
+	// subject.  Events are always published to their dialogs.  All events are
+	// published if it is nil.
+	EventFilter *eventfilter.Filter
+
+	// bootID identifies this run of the server in the sequence of its events
+	bootID string
+
+	// eventSeq is the sequence number of the last event published to the
+	// canonical event subjects.  It is accessed atomically.
+	eventSeq uint64
+
+	// ClaimTimeout is the amount of time within which a listener must claim
+	// a channel which has entered Stasis, once it has been offered on the
+	// claim subject, before it is offered again.  Channels are not offered if
+	// it is zero.
+	ClaimTimeout time.Duration
+
+	// ClaimAttempts is the number of times a channel is offered before the
+	// ClaimFallback is applied to it.  It defaults to DefaultClaimAttempts.
+	ClaimAttempts int
+
+	// ClaimFallback is applied to channels which are not claimed, or which
+	// enter Stasis while no listener is present.  Channels created through
+	// the proxy, or bound to a dialog, are exempt.
+	ClaimFallback fallback.Policy
+
+	// ListenerTTL is the amount of time for which a listener (see
+	// client.Listen) is considered present after it last announced itself.
+	// If it is positive, the ClaimFallback is applied to channels which enter
+	// Stasis while no listener is present.
+	ListenerTTL time.Duration
+
+	// claims tracks the channels which have been offered to be claimed
+	claims *claimTracker
+
+	// media tracks the playbacks and live recordings in progress
+	media *mediaTracker
+
+	// EventBuffer retains the recent events published to the canonical event
+	// subjects, so that they may be replayed to clients which missed them.
+	// Events are not retained if it is nil.
+	EventBuffer *eventbuf.Buffer
+
+	// Codec is the codec in which events are published.  It defaults to the
+	// JSON codec.  Requests are accepted in any of the supported codecs,
+	// which are announced to clients, and answered in the codec of the
+	// request.
+	Codec messagebus.Codec
+
+	// replyHooks holds the interceptors for responses to internal reply
+	// subjects, keyed by those subjects.
+	replyHooks sync.Map
+
 	readyCh chan struct{}
 
 	// cancel is the context cancel function, by which all subtended subscriptions may be terminated
@@ -56,7 +164,17 @@ func New() *Server {
 		MBPrefix: "ari.",
 		readyCh:  make(chan struct{}),
 		Dialog:   dialog.NewMemManager(),
+		Dedupe:   dedupe.New(dedupe.DefaultTTL, dedupe.DefaultSize),
 		Log:      log,
+		bootID:   rid.New("bt"),
+		claims:   newClaimTracker(),
+		media:    newMediaTracker(),
+
+		EventFilter: eventfilter.New(eventfilter.Rule{}),
+		EventBuffer: eventbuf.New(eventbuf.DefaultSize),
+
+		DialogSweepInterval: DefaultDialogSweepInterval,
+		DialogMaxAge:        DefaultDialogMaxAge,
 	}
 }
 
@@ -76,12 +194,12 @@ func (s *Server) Listen(ctx context.Context, ariOpts *native.Options, messagebus
 	switch mbtype {
 	case messagebus.TypeRabbitmq:
 		s.mbus = &messagebus.RabbitmqBus{
-			Config: messagebus.Config{URL: messagebusURL},
+			Config: messagebus.Config{URL: messagebusURL, Codec: s.Codec},
 			Log:    s.Log,
 		}
 	case messagebus.TypeNats:
 		s.mbus = &messagebus.NatsBus{
-			Config: messagebus.Config{URL: messagebusURL},
+			Config: messagebus.Config{URL: messagebusURL, Codec: s.Codec},
 			Log:    s.Log,
 		}
 	default:
@@ -105,7 +223,7 @@ func (s *Server) ListenOn(ctx context.Context, a ari.Client, n *nats.EncodedConn
 
 	s.ari = a
 	s.mbus = messagebus.NewNatsBus(
-		messagebus.Config{},
+		messagebus.Config{Codec: s.Codec},
 		messagebus.WithNatsConn(n),
 	)
 
@@ -148,6 +266,11 @@ func (s *Server) listen(ctx context.Context) error {
 	// Store the ARI application name for top-level access
 	s.Application = s.ari.ApplicationName()
 
+	s.dialogGC = dialog.NewGC(s.Dialog, s.DialogMaxAge)
+	if len(s.DialogPropagation.Rules) > 0 {
+		s.propagator = dialog.NewPropagator(s.Dialog, s.DialogPropagation)
+	}
+
 	//
 	// Listen on the initial MessageBus subjects
 	//
@@ -159,6 +282,18 @@ func (s *Server) listen(ctx context.Context) error {
 	}
 	defer wg.Add(testPingSub.Unsubscribe)
 
+	// listener presence
+	if s.ListenerTTL > 0 {
+		// Listeners are assumed present until they have had a chance to announce themselves
+		s.listenerAnnounced()
+
+		listenerSub, err := s.mbus.SubscribePing(proxy.ListenerSubject(s.MBPrefix, s.Application), s.listenerAnnounced)
+		if err != nil {
+			return eris.Wrap(err, "failed to subscribe to listener announcements")
+		}
+		defer wg.Add(listenerSub.Unsubscribe)
+	}
+
 	// get a contextualized request handler
 	requestHandler := s.newRequestHandler(ctx)
 
@@ -207,8 +342,8 @@ func (s *Server) listen(ctx context.Context) error {
 	// Run the entity check handler
 	go s.runEntityChecker(ctx)
 
-	// TODO: run the dialog cleanup routine (remove bindings for entities which no longer exist)
-	// go s.runDialogCleaner(ctx)
+	// Run the dialog cleanup routine (remove bindings for entities which no longer exist)
+	go s.runDialogCleaner(ctx)
 
 	// Close the readyChannel to indicate that we are operational
 	if s.readyCh != nil {
@@ -262,11 +397,38 @@ func (s *Server) runAnnouncer(ctx context.Context) {
 // announce publishes the presence of this server to the cluster
 func (s *Server) announce() {
 	s.publishAnnounce(proxy.AnnouncementSubject(s.MBPrefix), &proxy.Announcement{
-		Node:        s.AsteriskID,
-		Application: s.Application,
+		Node:         s.AsteriskID,
+		Application:  s.Application,
+		Codecs:       messagebus.CodecNames(),
+		Version:      proxy.ProtocolVersion,
+		Capabilities: s.capabilities(),
 	})
 }
 
+// capabilities returns the capabilities which the server announces: those of
+// proxy.Capabilities which its configuration enables
+func (s *Server) capabilities() []string {
+	var ret []string
+	for _, c := range proxy.Capabilities {
+		switch c {
+		case proxy.CapabilityClaims:
+			if s.ClaimTimeout <= 0 {
+				continue
+			}
+		case proxy.CapabilityEventFilter:
+			if s.EventFilter == nil {
+				continue
+			}
+		case proxy.CapabilityEventReplay:
+			if s.EventBuffer == nil {
+				continue
+			}
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
+
 // runEventHandler processes events which are received from ARI
 func (s *Server) runEventHandler(ctx context.Context) {
 	sub := s.ari.Bus().Subscribe(nil, ari.Events.All)
@@ -280,15 +442,35 @@ func (s *Server) runEventHandler(ctx context.Context) {
 		case e := <-sub.Events():
 			s.Log.Debug("event received", "kind", e.GetType())
 
-			// Publish event to canonical destination
-			s.publishEvent(fmt.Sprintf("%sevent.%s.%s", s.MBPrefix, s.Application, s.AsteriskID), e)
+			// Publish event to canonical destination, stamped with its sequence
+			pe := e
+			if s.EventFilter == nil || s.EventFilter.AllowEvent(e) {
+				se := s.sequenceEvent(e)
+				s.publishCanonicalEvent(se)
+				s.bufferEvent(se)
+				pe = se
+			}
+
+			// Bind any related entities before publishing to dialogs
+			if s.propagator != nil {
+				s.propagator.Handle(e)
+			}
 
 			// Publish event to any associated dialogs
 			for _, d := range s.dialogsForEvent(e) {
-				de := e
+				de := pe
 				de.SetDialog(d)
 				s.publishEvent(fmt.Sprintf("%sdialogevent.%s", s.MBPrefix, d), de)
 			}
+
+			// Offer channels which enter Stasis to be claimed
+			s.handleClaims(ctx, e)
+
+			// Follow the playbacks and live recordings in progress
+			s.media.handle(e)
+
+			// Remove the bindings of entities which have ended
+			s.releaseBindings(e)
 		}
 	}
 }
@@ -302,6 +484,11 @@ func (s *Server) pingHandler() {
 
 // publish sends a message out over MessageBus, logging any error
 func (s *Server) publish(subject string, msg *proxy.Response) {
+	if fn, ok := s.replyHooks.LoadAndDelete(subject); ok {
+		fn.(func(*proxy.Response))(msg)
+		return
+	}
+
 	if err := s.mbus.PublishResponse(subject, msg); err != nil {
 		s.Log.Warn("failed to publish MessageBus message", "subject", subject, "data", msg, "error", err)
 	}
@@ -321,23 +508,92 @@ func (s *Server) publishEvent(subject string, msg ari.Event) {
 	}
 }
 
+// interceptReply returns an internal reply subject which may be handed to
+// request handlers in place of a real one.  The first response published to
+// that subject is passed to fn instead of being sent over the MessageBus.
+func (s *Server) interceptReply(fn func(*proxy.Response)) string {
+	subject := rid.New("ir")
+	s.replyHooks.Store(subject, fn)
+	return subject
+}
+
 // newRequestHandler returns a context-wrapped Handler to handle requests
 func (s *Server) newRequestHandler(ctx context.Context) func(subject string, reply string, req *proxy.Request) {
 	return func(subject string, reply string, req *proxy.Request) {
+		class := requestClass(s.MBPrefix, subject)
+
+		reply = s.auditReply(class, reply, req)
+
 		if !s.ari.Connected() {
 			s.sendError(reply, eris.New("ARI connection is down"))
 			return
 		}
+
+		if err := proxy.CheckVersion(req.Version); err != nil {
+			s.sendError(reply, err)
+			return
+		}
+
+		if resp := s.rateLimit(req); resp != nil {
+			s.publish(reply, resp)
+			return
+		}
+
+		if s.Dedupe != nil && req.IdempotencyKey != "" && mutatingClass(class) {
+			if wait := s.Dedupe.Begin(req.IdempotencyKey); wait != nil {
+				s.Log.Debug("duplicate request received", "kind", req.Kind, "idempotency_key", req.IdempotencyKey)
+				go s.replyDuplicate(ctx, reply, req.IdempotencyKey, wait)
+				return
+			}
+			reply = s.dedupeReply(reply, req.IdempotencyKey)
+		}
+
 		go s.dispatchRequest(ctx, reply, req)
 	}
 }
 
+// rateLimit applies the rate limits to the given request, returning the
+// rejection response if the request should not be executed.
+func (s *Server) rateLimit(req *proxy.Request) *proxy.Response {
+	if s.RateLimit == nil {
+		return nil
+	}
+	if ok, wait := s.RateLimit.Allow(req.Kind, s.Application, req.Client); !ok {
+		s.Log.Warn("request rate limited", "kind", req.Kind, "client", req.Client, "retry_after", wait)
+		return proxy.NewRateLimitResponse(wait)
+	}
+	return nil
+}
+
+// RateLimitStats returns the number of requests which have been rejected by
+// the rate limiter, indexed by the type of limit (kind, application, or
+// client) which rejected them.  It returns nil if no rate limiter is set.
+func (s *Server) RateLimitStats() map[string]int64 {
+	if s.RateLimit == nil {
+		return nil
+	}
+	return s.RateLimit.Throttled()
+}
+
+// requestClass returns the request class (get, data, command, create) from the subject on which a request was received
+func requestClass(prefix, subject string) string {
+	class := strings.TrimPrefix(subject, prefix)
+	if i := strings.Index(class, "."); i >= 0 {
+		class = class[:i]
+	}
+	return class
+}
+
 // TODO: see if there is a more programmatic approach to this
 // nolint: gocyclo
 func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.Request) {
 	var f func(context.Context, string, *proxy.Request)
 
 	s.Log.Debug("received request", "kind", req.Kind)
+
+	reply = s.claimCreateReply(reply, req)
+	s.claimTouched(req)
+
 	switch req.Kind {
 	case "ApplicationData":
 		f = s.applicationData
@@ -385,6 +641,8 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.asteriskVariableGet
 	case "AsteriskVariableSet":
 		f = s.asteriskVariableSet
+	case "Batch":
+		f = s.batch
 	case "BridgeAddChannel":
 		f = s.bridgeAddChannel
 	case "BridgeCreate":
@@ -425,6 +683,8 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.channelAnswer
 	case "ChannelBusy":
 		f = s.channelBusy
+	case "ChannelClaim":
+		f = s.channelClaim
 	case "ChannelCongestion":
 		f = s.channelCongestion
 	case "ChannelCreate":
@@ -499,6 +759,16 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.deviceStateList
 	case "DeviceStateUpdate":
 		f = s.deviceStateUpdate
+	case "DialogBind":
+		f = s.dialogBind
+	case "DialogBindings":
+		f = s.dialogBindings
+	case "DialogClose":
+		f = s.dialogClose
+	case "DialogList":
+		f = s.dialogList
+	case "DialogUnbind":
+		f = s.dialogUnbind
 	case "EndpointData":
 		f = s.endpointData
 	case "EndpointGet":
@@ -507,6 +777,12 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.endpointList
 	case "EndpointListByTech":
 		f = s.endpointListByTech
+	case "EventFilter":
+		f = s.eventFilter
+	case "EventFilterSet":
+		f = s.eventFilterSet
+	case "EventReplay":
+		f = s.eventReplay
 	case "MailboxData":
 		f = s.mailboxData
 	case "MailboxDelete":
@@ -517,6 +793,8 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.mailboxList
 	case "MailboxUpdate":
 		f = s.mailboxUpdate
+	case "NodeSnapshot":
+		f = s.nodeSnapshot
 	case "PlaybackControl":
 		f = s.playbackControl
 	case "PlaybackData":
@@ -561,6 +839,10 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.soundList
 	case "ChannelUserEvent":
 		f = s.channelUserEvent
+	case "TextMessageSend":
+		f = s.textMessageSend
+	case "TextMessageSendByURI":
+		f = s.textMessageSendByURI
 	default:
 		f = func(ctx context.Context, reply string, req *proxy.Request) {
 			s.sendError(reply, eris.New("Not implemented"))
@@ -573,49 +855,3 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 func (s *Server) sendError(reply string, err error) {
 	s.publish(reply, proxy.NewErrorResponse(err))
 }
-
-/*
-// Start runs the server side instance
-func (i *Instance) Start(ctx context.Context) {
-	i.ctx, i.cancel = context.WithCancel(ctx)
-
-	i.log.Debug("Starting dialog instance")
-
-	go func() {
-		i.application()
-		i.asterisk()
-		i.modules()
-		i.channel()
-		i.storedRecording()
-		i.liveRecording()
-		i.bridge()
-		i.device()
-		i.playback()
-		i.mailbox()
-		i.sound()
-		i.logging()
-		i.config()
-
-		// do commands last, since that is the one that will be dispatching
-		i.commands()
-
-		close(i.readyCh)
-
-		<-i.ctx.Done()
-	}()
-
-	<-i.readyCh
-}
-
-// Stop stops the instance
-func (i *Instance) Stop() {
-	if i == nil {
-		return
-	}
-	i.cancel()
-}
-
-func (i *Instance) String() string {
-	return fmt.Sprintf("Instance{%s}", i.Dialog.ID)
-}
-*/
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// mediaTracker follows the playbacks and live recordings in progress, which
+// ARI does not list, from the events of the application
+type mediaTracker struct {
+	playbacks  map[string]*ari.Key
+	recordings map[string]*ari.Key
+
+	mu sync.Mutex
+}
+
+func newMediaTracker() *mediaTracker {
+	return &mediaTracker{
+		playbacks:  make(map[string]*ari.Key),
+		recordings: make(map[string]*ari.Key),
+	}
+}
+
+// handle records the playbacks and live recordings which start and end
+func (t *mediaTracker) handle(e ari.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch v := e.(type) {
+	case *ari.PlaybackStarted:
+		t.playbacks[v.Playback.ID] = v.Key(ari.PlaybackKey, v.Playback.ID)
+	case *ari.PlaybackFinished:
+		delete(t.playbacks, v.Playback.ID)
+	case *ari.RecordingStarted:
+		t.recordings[v.Recording.Name] = v.Key(ari.LiveRecordingKey, v.Recording.Name)
+	case *ari.RecordingFinished:
+		delete(t.recordings, v.Recording.Name)
+	case *ari.RecordingFailed:
+		delete(t.recordings, v.Recording.Name)
+	}
+}
+
+func (t *mediaTracker) keys() (playbacks, recordings []*ari.Key) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, k := range t.playbacks {
+		playbacks = append(playbacks, k)
+	}
+	for _, k := range t.recordings {
+		recordings = append(recordings, k)
+	}
+	return playbacks, recordings
+}
+
+func (s *Server) nodeSnapshot(ctx context.Context, reply string, req *proxy.Request) {
+	// The position in the event stream is taken before the entities are
+	// retrieved, so that the snapshot reflects the events up to it
+	snap := &proxy.NodeSnapshot{
+		Node: s.AsteriskID,
+		Sequences: map[string]proxy.EventSequence{
+			s.AsteriskID: {
+				Seq:  atomic.LoadUint64(&s.eventSeq),
+				Boot: s.bootID,
+			},
+		},
+	}
+
+	channels, err := s.ari.Channel().List(nil)
+	if err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to list channels"))
+		return
+	}
+	for _, k := range channels {
+		// Entities which end while the snapshot is taken are omitted
+		if d, err := s.ari.Channel().Data(k); err == nil {
+			snap.Channels = append(snap.Channels, d)
+		}
+	}
+
+	bridges, err := s.ari.Bridge().List(nil)
+	if err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to list bridges"))
+		return
+	}
+	for _, k := range bridges {
+		if d, err := s.ari.Bridge().Data(k); err == nil {
+			snap.Bridges = append(snap.Bridges, d)
+		}
+	}
+
+	devices, err := s.ari.DeviceState().List(nil)
+	if err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to list device states"))
+		return
+	}
+	for _, k := range devices {
+		if d, err := s.ari.DeviceState().Data(k); err == nil {
+			snap.DeviceStates = append(snap.DeviceStates, d)
+		}
+	}
+
+	playbacks, recordings := s.media.keys()
+	for _, k := range playbacks {
+		if d, err := s.ari.Playback().Data(k); err == nil {
+			snap.Playbacks = append(snap.Playbacks, d)
+		}
+	}
+	for _, k := range recordings {
+		if d, err := s.ari.LiveRecording().Data(k); err == nil {
+			snap.LiveRecordings = append(snap.LiveRecordings, d)
+		}
+	}
+
+	s.publish(reply, &proxy.Response{
+		Snapshot: snap,
+	})
+}
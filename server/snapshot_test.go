@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+func TestNodeSnapshot(t *testing.T) {
+	c1 := ari.NewKey(ari.ChannelKey, "c1")
+	c2 := ari.NewKey(ari.ChannelKey, "c2")
+	b1 := ari.NewKey(ari.BridgeKey, "b1")
+	d1 := ari.NewKey(ari.DeviceStateKey, "Custom:d1")
+
+	ch := &arimocks.Channel{}
+	ch.On("List", (*ari.Key)(nil)).Return([]*ari.Key{c1, c2}, nil)
+	ch.On("Data", c1).Return(&ari.ChannelData{ID: "c1"}, nil)
+	ch.On("Data", c2).Return(nil, errors.New("not found"))
+
+	br := &arimocks.Bridge{}
+	br.On("List", (*ari.Key)(nil)).Return([]*ari.Key{b1}, nil)
+	br.On("Data", b1).Return(&ari.BridgeData{ID: "b1"}, nil)
+
+	ds := &arimocks.DeviceState{}
+	ds.On("List", (*ari.Key)(nil)).Return([]*ari.Key{d1}, nil)
+	ds.On("Data", d1).Return(&ari.DeviceStateData{Name: "Custom:d1", State: "INUSE"}, nil)
+
+	s := New()
+	s.Application = "asdf"
+	s.AsteriskID = "1"
+
+	pk := ari.NewKey(ari.PlaybackKey, "p1", ari.WithApp("asdf"), ari.WithNode("1"))
+	pb := &arimocks.Playback{}
+	pb.On("Data", pk).Return(&ari.PlaybackData{ID: "p1"}, nil)
+
+	cl := &arimocks.Client{}
+	cl.On("Channel").Return(ch)
+	cl.On("Bridge").Return(br)
+	cl.On("DeviceState").Return(ds)
+	cl.On("Playback").Return(pb)
+	s.ari = cl
+
+	ed := ari.EventData{Application: "asdf", Node: "1"}
+	s.media.handle(&ari.PlaybackStarted{EventData: ed, Playback: ari.PlaybackData{ID: "p1"}})
+	s.media.handle(&ari.PlaybackStarted{EventData: ed, Playback: ari.PlaybackData{ID: "p2"}})
+	s.media.handle(&ari.PlaybackFinished{EventData: ed, Playback: ari.PlaybackData{ID: "p2"}})
+
+	s.sequenceEvent(&ari.StasisStart{EventData: ed})
+	s.sequenceEvent(&ari.StasisStart{EventData: ed})
+
+	var resp *proxy.Response
+	s.dispatchRequest(context.Background(), s.interceptReply(func(r *proxy.Response) {
+		resp = r
+	}), &proxy.Request{
+		Kind: "NodeSnapshot",
+		Key:  ari.NewKey("", "", ari.WithApp("asdf"), ari.WithNode("1")),
+	})
+
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	snap := resp.Snapshot
+	if snap == nil || snap.Node != "1" {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+	if len(snap.Channels) != 1 || snap.Channels[0].ID != "c1" {
+		t.Errorf("expected the channel which ended to be omitted: %v", snap.Channels)
+	}
+	if len(snap.Bridges) != 1 || len(snap.DeviceStates) != 1 {
+		t.Errorf("unexpected bridges or device states: %v %v", snap.Bridges, snap.DeviceStates)
+	}
+	if len(snap.Playbacks) != 1 || snap.Playbacks[0].ID != "p1" {
+		t.Errorf("expected only the playback in progress: %v", snap.Playbacks)
+	}
+	if len(snap.LiveRecordings) != 0 {
+		t.Errorf("unexpected live recordings: %v", snap.LiveRecordings)
+	}
+	if seq := snap.Sequences["1"]; seq.Seq != 2 || seq.Boot != s.bootID {
+		t.Errorf("unexpected snapshot sequence: %+v", snap.Sequences)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"sort"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+func (s *Server) textMessageSend(ctx context.Context, reply string, req *proxy.Request) {
+	m := req.TextMessageSend
+	if m == nil || m.Tech == "" || m.Resource == "" {
+		s.sendError(reply, eris.New("TextMessageSend with endpoint tech and resource is mandatory"))
+		return
+	}
+
+	if err := s.ari.TextMessage().Send(m.From, m.Tech, m.Resource, m.Body, m.Variables); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	// Bind the endpoint to the dialog, so that the replies to the message
+	// (TextMessageReceived events) are delivered to the dialog
+	endpoint := m.Tech + "/" + m.Resource
+	if req.Key != nil && req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, ari.EndpointKey, endpoint)
+	}
+
+	k := s.textMessageKey(endpoint)
+	s.publish(reply, &proxy.Response{
+		Key: k,
+		Data: &proxy.EntityData{
+			TextMessage: textMessageData(k, m.From, endpoint, m.Body, m.Variables),
+		},
+	})
+}
+
+func (s *Server) textMessageSendByURI(ctx context.Context, reply string, req *proxy.Request) {
+	m := req.TextMessageSendByURI
+	if m == nil || m.To == "" {
+		s.sendError(reply, eris.New("TextMessageSendByURI with destination URI is mandatory"))
+		return
+	}
+
+	if err := s.ari.TextMessage().SendByURI(m.From, m.To, m.Body, m.Variables); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Data: &proxy.EntityData{
+			TextMessage: textMessageData(nil, m.From, m.To, m.Body, m.Variables),
+		},
+	})
+}
+
+// textMessageKey returns the key of the endpoint to which a text message was
+// sent
+func (s *Server) textMessageKey(endpoint string) *ari.Key {
+	return ari.NewKey(ari.EndpointKey, endpoint, ari.WithApp(s.Application), ari.WithNode(s.AsteriskID))
+}
+
+// textMessageData describes a text message which has been sent
+func textMessageData(key *ari.Key, from, to, body string, vars map[string]string) *ari.TextMessageData {
+	ret := &ari.TextMessageData{
+		Key:  key,
+		Body: body,
+		From: from,
+		To:   to,
+	}
+	for k, v := range vars {
+		ret.Variables = append(ret.Variables, ari.TextMessageVariable{Key: k, Value: v})
+	}
+	sort.Slice(ret.Variables, func(i, j int) bool {
+		return ret.Variables[i].Key < ret.Variables[j].Key
+	})
+	return ret
+}
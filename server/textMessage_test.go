@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/internal/integration"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+func TestTextMessageSend(t *testing.T) {
+	integration.TestTextMessageSend(t, &srv{})
+}
+
+func TestTextMessageSendByURI(t *testing.T) {
+	integration.TestTextMessageSendByURI(t, &srv{})
+}
+
+func TestTextMessageDialog(t *testing.T) {
+	s, _ := newBatchTestServer()
+
+	tm := &arimocks.TextMessage{}
+	tm.On("Send", "pjsip:me", "PJSIP", "1000", "hello", map[string]string{"b": "2", "a": "1"}).Return(nil)
+	s.ari.(*arimocks.Client).On("TextMessage").Return(tm)
+
+	var resp *proxy.Response
+	s.dispatchRequest(context.Background(), s.interceptReply(func(r *proxy.Response) {
+		resp = r
+	}), &proxy.Request{
+		Kind: "TextMessageSend",
+		Key:  ari.NewKey("", "", ari.WithDialog("d1")),
+		TextMessageSend: &proxy.TextMessageSend{
+			From:      "pjsip:me",
+			Tech:      "PJSIP",
+			Resource:  "1000",
+			Body:      "hello",
+			Variables: map[string]string{"b": "2", "a": "1"},
+		},
+	})
+
+	if resp == nil || resp.Err() != nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Key == nil || resp.Key.Kind != ari.EndpointKey || resp.Key.ID != "PJSIP/1000" || resp.Key.Node != "1" {
+		t.Errorf("unexpected key of sent message: %v", resp.Key)
+	}
+	if m := resp.Data.TextMessage; m == nil || m.To != "PJSIP/1000" || len(m.Variables) != 2 || m.Variables[0].Key != "a" {
+		t.Errorf("unexpected text message data: %+v", m)
+	}
+
+	// Replies to the message are delivered to the dialog
+	if list := s.Dialog.List(ari.EndpointKey, "PJSIP/1000"); len(list) != 1 || list[0] != "d1" {
+		t.Errorf("expected endpoint to be bound to dialog d1, got %v", list)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+func TestProtocolVersion(t *testing.T) {
+	s, ch := newBatchTestServer()
+	s.ari.(*arimocks.Client).On("Connected").Return(true)
+
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	ch.On("Data", key).Return(&ari.ChannelData{ID: "c1"}, nil)
+
+	h := s.newRequestHandler(context.Background())
+	request := func(version int) *proxy.Response {
+		respCh := make(chan *proxy.Response, 1)
+		h("ari.data.asdf.1", s.interceptReply(func(r *proxy.Response) {
+			respCh <- r
+		}), &proxy.Request{Kind: "ChannelData", Key: key, Version: version})
+
+		select {
+		case r := <-respCh:
+			return r
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for response")
+		}
+		return nil
+	}
+
+	for _, v := range []int{0, proxy.ProtocolVersion} {
+		if err := request(v).Err(); err != nil {
+			t.Errorf("request of version %d failed: %v", v, err)
+		}
+	}
+
+	err := request(proxy.ProtocolVersion + 1).Err()
+	if err == nil || !strings.Contains(err.Error(), "unsupported protocol version") {
+		t.Errorf("expected request of a newer version to be rejected, got %v", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	has := func(caps []string, c string) bool {
+		for _, v := range caps {
+			if v == c {
+				return true
+			}
+		}
+		return false
+	}
+
+	s := New()
+	s.EventBuffer = nil
+	caps := s.capabilities()
+	for _, c := range []string{proxy.CapabilityClaims, proxy.CapabilityEventReplay} {
+		if has(caps, c) {
+			t.Errorf("capability %s should not be announced when disabled: %v", c, caps)
+		}
+	}
+	if !has(caps, proxy.CapabilityBatch) {
+		t.Errorf("expected capability %s: %v", proxy.CapabilityBatch, caps)
+	}
+
+	s.ClaimTimeout = time.Second
+	s.EventBuffer = New().EventBuffer
+	if caps := s.capabilities(); len(caps) != len(proxy.Capabilities) {
+		t.Errorf("expected every capability to be announced, got %v", caps)
+	}
+}
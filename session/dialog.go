@@ -1,5 +1,10 @@
 package session
 
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
 // A Dialog is a session between the ARI proxy client and the ARI proxy server
 type Dialog struct {
 	ID        string
@@ -15,3 +20,59 @@ func NewDialog(id string, transport Transport) *Dialog {
 		Transport: transport,
 	}
 }
+
+// Key returns a copy of the given key which is scoped to the dialog
+func (d *Dialog) Key(key *ari.Key) *ari.Key {
+	if key == nil {
+		return ari.NewKey("", "", ari.WithDialog(d.ID))
+	}
+	return ari.NewKey(key.Kind, key.ID, ari.WithLocationOf(key), ari.WithDialog(d.ID))
+}
+
+// Command sends the given request within the dialog.  The IDs of any entities
+// created by the request are added to the dialog's Objects.
+func (d *Dialog) Command(class string, req *proxy.Request) (*proxy.Response, error) {
+	if req != nil {
+		req.Key = d.Key(req.Key)
+		if req.Batch != nil && req.Batch.Dialog == "" {
+			req.Batch.Dialog = d.ID
+		}
+	}
+
+	resp, err := d.Transport.Command(class, req)
+	if err != nil || resp == nil || class != "create" {
+		return resp, err
+	}
+
+	d.track(resp)
+	for _, r := range resp.Responses {
+		d.track(r)
+	}
+
+	return resp, nil
+}
+
+func (d *Dialog) track(resp *proxy.Response) {
+	if resp != nil && resp.Err() == nil && resp.Key != nil && resp.Key.ID != "" {
+		d.Objects.Add(resp.Key.ID)
+	}
+}
+
+// Subscribe subscribes to the given types of events of the dialog
+func (d *Dialog) Subscribe(n ...string) ari.Subscription {
+	return d.Transport.Subscribe(d.ID, n...)
+}
+
+// Close releases all of the dialog's bindings on the server
+func (d *Dialog) Close() error {
+	d.Objects.Clear()
+
+	resp, err := d.Transport.Command("command", &proxy.Request{
+		Kind: "DialogClose",
+		Key:  ari.NewKey(proxy.DialogKey, d.ID, ari.WithDialog(d.ID)),
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Err()
+}
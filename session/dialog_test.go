@@ -0,0 +1,71 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+type testTransport struct {
+	requests []*proxy.Request
+	resp     *proxy.Response
+}
+
+func (t *testTransport) Command(class string, req *proxy.Request) (*proxy.Response, error) {
+	t.requests = append(t.requests, req)
+	if t.resp != nil {
+		return t.resp, nil
+	}
+	return &proxy.Response{}, nil
+}
+
+func (t *testTransport) Subscribe(dialog string, n ...string) ari.Subscription {
+	return nil
+}
+
+func TestDialogCommand(t *testing.T) {
+	tr := &testTransport{}
+	d := NewDialog("d1", tr)
+
+	key := ari.NewKey(ari.ChannelKey, "c1", ari.WithNode("n1"))
+	if _, err := d.Command("command", &proxy.Request{Kind: "ChannelAnswer", Key: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := tr.requests[0].Key
+	if sent.Dialog != "d1" || sent.ID != "c1" || sent.Node != "n1" {
+		t.Errorf("request key was not scoped to the dialog: %v", sent)
+	}
+	if key.Dialog != "" {
+		t.Error("caller's key was modified")
+	}
+	if len(d.Objects.Items()) != 0 {
+		t.Error("command should not add objects")
+	}
+
+	tr.resp = &proxy.Response{Key: ari.NewKey(ari.BridgeKey, "b1")}
+	if _, err := d.Command("create", &proxy.Request{Kind: "BridgeCreate"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Objects.Contains("b1"); !ok {
+		t.Error("created entity was not tracked")
+	}
+}
+
+func TestDialogClose(t *testing.T) {
+	tr := &testTransport{}
+	d := NewDialog("d1", tr)
+	d.Objects.Add("c1")
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tr.requests) != 1 || tr.requests[0].Kind != "DialogClose" || tr.requests[0].Key.Dialog != "d1" {
+		t.Errorf("unexpected close request: %v", tr.requests)
+	}
+	if len(d.Objects.Items()) != 0 {
+		t.Error("objects were not cleared")
+	}
+}
@@ -1,13 +1,16 @@
 package session
 
-import "github.com/CyCoreSystems/ari/v5"
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
 
-// Transport defines how the commands and events are sent.
+// Transport defines how the commands and events of a dialog are sent.
 type Transport interface {
 
-	// Command sends a command and waits for a response
-	Command(name string, body interface{}, resp interface{}) error
+	// Command sends a request of the given class ("get", "data", "command" or "create") and waits for its response
+	Command(class string, req *proxy.Request) (*proxy.Response, error)
 
-	// Event dispatches an event
-	Event(evt ari.Event) error
+	// Subscribe subscribes to the given types of events of the given dialog
+	Subscribe(dialog string, n ...string) ari.Subscription
 }